@@ -0,0 +1,286 @@
+package cache
+
+import "time"
+
+// UpdateFunc computes the new value of an entry from its current value. found
+// is false, and old the zero value, if the cache holds no live entry for the
+// key. The entry is set to value with the given ttl if keep is true, and
+// deleted otherwise. An UpdateFunc runs under the lock of the cache, so it must
+// not call back into the cache.
+type UpdateFunc[V any] func(old V, found bool) (value V, ttl time.Duration, keep bool)
+
+// GetMany looks up several entries under a single acquisition of the lock. The
+// returned map holds the live entries only. Every key counts as a lookup in
+// the cache statistics.
+func (c *ExpiringCache[K, V]) GetMany(keys []K) map[K]V {
+	now := c.clock.Now()
+	found := make(map[K]V, len(keys))
+
+	unlock := c.lockForRead()
+	defer unlock()
+	for _, key := range keys {
+		if val, ok := c.getLocked(now, key); ok {
+			found[key] = val
+		}
+	}
+	return found
+}
+
+// SetMany sets several entries with the same ttl under a single acquisition of
+// the lock. Entries heavier than the weight limit are skipped, and
+// ErrEntryTooLarge is returned once the others have been set.
+func (c *ExpiringCache[K, V]) SetMany(entries map[K]V, ttl time.Duration) error {
+	var err error
+	weights := make(map[K]int64, len(entries))
+	for key, val := range entries {
+		weight, werr := c.weigh(key, val)
+		if werr != nil {
+			err = werr
+			continue
+		}
+		weights[key] = weight
+	}
+	now := c.clock.Now()
+
+	var evicted []evictedEntry[K, V]
+	c.mu.Lock()
+	for key, weight := range weights {
+		evicted = append(evicted, c.putLocked(now, key, entries[key], weight, now.Add(ttl), ttl)...)
+	}
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return err
+}
+
+// SetIfAbsent sets the entry of key only if the cache holds no live entry for
+// it. It returns true if the entry was set. If val is heavier than the weight
+// limit of the cache, the cache is left unchanged and ErrEntryTooLarge is
+// returned.
+func (c *ExpiringCache[K, V]) SetIfAbsent(key K, val V, ttl time.Duration) (bool, error) {
+	weight, err := c.weigh(key, val)
+	if err != nil {
+		return false, err
+	}
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	if _, ok := c.liveLocked(now, key); ok {
+		c.mu.Unlock()
+		return false, nil
+	}
+	evicted := c.putLocked(now, key, val, weight, now.Add(ttl), ttl)
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return true, nil
+}
+
+// CompareAndSwap sets the entry of key to new only if the cache holds a live
+// entry for it whose value equals old. It returns true if the entry was set.
+// If new is heavier than the weight limit of the cache, the entry is left
+// unchanged and ErrEntryTooLarge is returned. The values are compared with ==,
+// so CompareAndSwap panics if they are not comparable.
+func (c *ExpiringCache[K, V]) CompareAndSwap(key K, old, new V, ttl time.Duration) (bool, error) {
+	weight, err := c.weigh(key, new)
+	if err != nil {
+		return false, err
+	}
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	e, ok := c.liveLocked(now, key)
+	if !ok || interface{}(e.val) != interface{}(old) {
+		c.mu.Unlock()
+		return false, nil
+	}
+	evicted := c.putLocked(now, key, new, weight, now.Add(ttl), ttl)
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return true, nil
+}
+
+// Update atomically replaces the entry of key with the result of f. It returns
+// the value the cache holds for key afterwards and whether it holds one. If the
+// new value is heavier than the weight limit of the cache, the entry is left
+// unchanged and ErrEntryTooLarge is returned.
+func (c *ExpiringCache[K, V]) Update(key K, f UpdateFunc[V]) (val V, ok bool, err error) {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	e, found := c.liveLocked(now, key)
+	val, ttl, keep := f(e.val, found)
+
+	var evicted []evictedEntry[K, V]
+	switch {
+	case keep:
+		var weight int64
+		weight, err = c.weigh(key, val)
+		if err == nil {
+			evicted = c.putLocked(now, key, val, weight, now.Add(ttl), ttl)
+		}
+	case found:
+		c.del(key, 0)
+		if c.onEvict != nil {
+			evicted = append(evicted, evictedEntry[K, V]{key: key, value: e.val, reason: Deleted})
+		}
+	}
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	if !keep || err != nil {
+		var zero V
+		return zero, false, err
+	}
+	return val, true, nil
+}
+
+// liveLocked returns the entry of key if it has not expired at now, without
+// counting the lookup.
+//
+// liveLocked must be called under the lock.
+func (c *ExpiringCache[K, V]) liveLocked(now time.Time, key K) (entry[K, V], bool) {
+	e, ok := c.cache[key]
+	if !ok || !now.Before(e.expiry) {
+		return entry[K, V]{}, false
+	}
+	return e, true
+}
+
+// GetMany looks up several entries under a single acquisition of the lock. The
+// returned map holds the live entries only. Every key counts as a lookup in
+// the cache statistics and updates the recency of its entry.
+func (c *LRUCache[K, V]) GetMany(keys []K) map[K]V {
+	now := c.clock.Now()
+	found := make(map[K]V, len(keys))
+
+	c.lock.Lock()
+	for _, key := range keys {
+		if value, ok := c.getLocked(now, key); ok {
+			found[key] = value
+		}
+	}
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return found
+}
+
+// SetMany adds several entries with the same ttl under a single acquisition of
+// the lock. Entries heavier than the weight limit are skipped, and
+// ErrEntryTooLarge is returned once the others have been added.
+func (c *LRUCache[K, V]) SetMany(entries map[K]V, ttl time.Duration) error {
+	now := c.clock.Now()
+
+	var err error
+	c.lock.Lock()
+	for key, value := range entries {
+		weight, werr := c.weigh(key, value)
+		if werr != nil {
+			err = werr
+			continue
+		}
+		c.addLocked(now, key, value, weight, ttl)
+	}
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return err
+}
+
+// SetIfAbsent adds the entry of key only if the cache holds no live entry for
+// it. It returns true if the entry was added.
+func (c *LRUCache[K, V]) SetIfAbsent(key K, value V, ttl time.Duration) (bool, error) {
+	weight, err := c.weigh(key, value)
+	if err != nil {
+		return false, err
+	}
+	now := c.clock.Now()
+
+	c.lock.Lock()
+	if _, ok := c.liveLocked(now, key); ok {
+		c.lock.Unlock()
+		return false, nil
+	}
+	c.addLocked(now, key, value, weight, ttl)
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return true, nil
+}
+
+// CompareAndSwap sets the entry of key to new only if the cache holds a live
+// entry for it whose value equals old. It returns true if the entry was set.
+// The values are compared with ==, so CompareAndSwap panics if they are not
+// comparable.
+func (c *LRUCache[K, V]) CompareAndSwap(key K, old, new V, ttl time.Duration) (bool, error) {
+	weight, err := c.weigh(key, new)
+	if err != nil {
+		return false, err
+	}
+	now := c.clock.Now()
+
+	c.lock.Lock()
+	e, ok := c.liveLocked(now, key)
+	if !ok || interface{}(e.value) != interface{}(old) {
+		c.lock.Unlock()
+		return false, nil
+	}
+	c.addLocked(now, key, new, weight, ttl)
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return true, nil
+}
+
+// Update atomically replaces the entry of key with the result of f. It returns
+// the value the cache holds for key afterwards and whether it holds one. If the
+// new value is heavier than the weight limit, the cache is left unchanged and
+// ErrEntryTooLarge is returned.
+func (c *LRUCache[K, V]) Update(key K, f UpdateFunc[V]) (value V, ok bool, err error) {
+	now := c.clock.Now()
+
+	c.lock.Lock()
+	var old V
+	e, found := c.liveLocked(now, key)
+	if found {
+		old = e.value
+	}
+	value, ttl, keep := f(old, found)
+	switch {
+	case keep:
+		var weight int64
+		weight, err = c.weigh(key, value)
+		if err == nil {
+			c.addLocked(now, key, value, weight, ttl)
+		}
+	case found:
+		c.policy.Remove(key)
+		c.removeLocked(key, Deleted)
+	}
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	if !keep || err != nil {
+		var zero V
+		return zero, false, err
+	}
+	return value, true, nil
+}
+
+// liveLocked returns the entry of key if it has not expired at now, without
+// counting the lookup or updating its recency. It must be called with lock
+// held.
+func (c *LRUCache[K, V]) liveLocked(now time.Time, key K) (*cacheEntry[V], bool) {
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expireTime) {
+		return nil, false
+	}
+	return e, true
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+func increment(old int, found bool) (int, time.Duration, bool) {
+	return old + 1, time.Hour, true
+}
+
+func TestExpiringUpdate(t *testing.T) {
+	c := NewExpiringCache[string, int]()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Update("counter", increment)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if v, ok := c.Get("counter"); !ok || v != 1000 {
+		t.Errorf("Expected 1000, true, got %d, %v", v, ok)
+	}
+}
+
+func TestExpiringUpdateDelete(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	r := &evictRecorder{}
+	c := NewExpiringWithClock(fc, WithEvictFunc(r.onEvict))
+	drop := func(old interface{}, found bool) (interface{}, time.Duration, bool) {
+		return nil, 0, false
+	}
+
+	if _, ok, _ := c.Update("a", drop); ok {
+		t.Errorf("expected no entry")
+	}
+	expectEvicted(t, r)
+
+	c.Set("a", "a1", time.Second)
+	if _, ok, _ := c.Update("a", drop); ok {
+		t.Errorf("expected no entry")
+	}
+	expectEvicted(t, r, evictRecord{"a", "a1", Deleted})
+
+	// An expired entry is not found.
+	c.Set("b", "b1", time.Second)
+	fc.Step(time.Second)
+	c.Update("b", func(old interface{}, found bool) (interface{}, time.Duration, bool) {
+		if found {
+			t.Errorf("expected expired entry not to be found, got %v", old)
+		}
+		return "b2", time.Second, true
+	})
+	expectEvicted(t, r, evictRecord{"b", "b1", Expired})
+}
+
+func TestExpiringConditionalSet(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewExpiringCacheWithClock[string, int](fc)
+
+	if ok, _ := c.SetIfAbsent("a", 1, time.Second); !ok {
+		t.Errorf("expected a to be set")
+	}
+	if ok, _ := c.SetIfAbsent("a", 2, time.Second); ok {
+		t.Errorf("expected a not to be set again")
+	}
+	if ok, _ := c.CompareAndSwap("a", 2, 3, time.Second); ok {
+		t.Errorf("expected swap of a stale value to fail")
+	}
+	if ok, _ := c.CompareAndSwap("a", 1, 3, time.Second); !ok {
+		t.Errorf("expected swap to succeed")
+	}
+	if v, _ := c.Get("a"); v != 3 {
+		t.Errorf("unexpected value: got=%d, want=3", v)
+	}
+
+	fc.Step(time.Second)
+	if ok, _ := c.CompareAndSwap("a", 3, 4, time.Second); ok {
+		t.Errorf("expected swap of an expired entry to fail")
+	}
+	if ok, _ := c.SetIfAbsent("a", 5, time.Second); !ok {
+		t.Errorf("expected expired a to be replaced")
+	}
+}
+
+func TestExpiringGetSetMany(t *testing.T) {
+	c := NewExpiringCache[string, int]()
+	if err := c.SetMany(map[string]int{"a": 1, "b": 2}, time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := c.GetMany([]string{"a", "b", "c"})
+	if want := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entries: got=%v, want=%v", got, want)
+	}
+	if s := c.Stats(); s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+}
+
+func TestExpiringConditionalSetWeighted(t *testing.T) {
+	r := &evictRecorder{}
+	c := NewExpiringCache[string, string](
+		WithWeigher(4, func(key, value string) int64 { return int64(len(value)) }),
+		WithEvictFunc(func(key, value string, reason EvictReason) { r.onEvict(key, value, reason) }))
+
+	if ok, err := c.SetIfAbsent("a", "1", time.Hour); !ok || err != nil {
+		t.Errorf("expected a to be set, got %v, %v", ok, err)
+	}
+	if ok, err := c.SetIfAbsent("b", "12345", time.Hour); ok || err != ErrEntryTooLarge {
+		t.Errorf("expected b to be rejected, got %v, %v", ok, err)
+	}
+	if ok, err := c.CompareAndSwap("a", "1", "12345", time.Hour); ok || err != ErrEntryTooLarge {
+		t.Errorf("expected the swap to be rejected, got %v, %v", ok, err)
+	}
+	if _, _, err := c.Update("a", func(old string, found bool) (string, time.Duration, bool) {
+		return "12345", time.Hour, true
+	}); err != ErrEntryTooLarge {
+		t.Errorf("expected the update to be rejected, got %v", err)
+	}
+	// An oversized Set drops the new value and keeps the old one.
+	c.Set("a", "12345", time.Hour)
+	expectEvicted(t, r, evictRecord{"a", "12345", Evicted})
+	// SetMany sets the entries which fit.
+	if err := c.SetMany(map[string]string{"a": "12", "c": "12345"}, time.Hour); err != ErrEntryTooLarge {
+		t.Errorf("expected c to be rejected, got %v", err)
+	}
+	expectEvicted(t, r, evictRecord{"a", "1", Replaced})
+
+	got := c.GetMany([]string{"a", "b", "c"})
+	if want := map[string]string{"a": "12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entries: got=%v, want=%v", got, want)
+	}
+}
+
+func TestLRUUpdate(t *testing.T) {
+	c := NewLRUCache[string, int](2)
+	for i := 0; i < 3; i++ {
+		c.Update("counter", increment)
+	}
+	if v, ok := c.Get("counter"); !ok || v != 3 {
+		t.Errorf("Expected 3, true, got %d, %v", v, ok)
+	}
+
+	if _, ok, _ := c.Update("counter", func(int, bool) (int, time.Duration, bool) {
+		return 0, 0, false
+	}); ok {
+		t.Errorf("expected no entry")
+	}
+	if c.Len() != 0 {
+		t.Errorf("unexpected length: %d", c.Len())
+	}
+}
+
+func TestLRUConditionalSetWeighted(t *testing.T) {
+	c := NewLRUCache[string, string](0, WithWeigher(4, func(key, value string) int64 {
+		return int64(len(value))
+	}))
+
+	if ok, err := c.SetIfAbsent("a", "1", time.Hour); !ok || err != nil {
+		t.Errorf("expected a to be set, got %v, %v", ok, err)
+	}
+	if ok, err := c.CompareAndSwap("a", "1", "12345", time.Hour); ok || err != ErrEntryTooLarge {
+		t.Errorf("expected ErrEntryTooLarge, got %v, %v", ok, err)
+	}
+	if ok, err := c.CompareAndSwap("a", "1", "12", time.Hour); !ok || err != nil {
+		t.Errorf("expected swap to succeed, got %v, %v", ok, err)
+	}
+
+	err := c.SetMany(map[string]string{"b": "1", "c": "12345"}, time.Hour)
+	if err != ErrEntryTooLarge {
+		t.Errorf("expected ErrEntryTooLarge, got %v", err)
+	}
+	got := c.GetMany([]string{"a", "b", "c"})
+	if want := map[string]string{"a": "12", "b": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected entries: got=%v, want=%v", got, want)
+	}
+}
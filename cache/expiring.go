@@ -2,6 +2,7 @@ package cache
 
 import (
 	"container/heap"
+	"context"
 	"sync"
 	"time"
 
@@ -9,27 +10,60 @@ import (
 )
 
 // NewExpiring returns an initialized expiring cache.
-func NewExpiring() *Expiring {
-	return NewExpiringWithClock(clock.RealClock{})
+func NewExpiring(opts ...ExpiringOption) *Expiring {
+	return NewExpiringCache[interface{}, interface{}](opts...)
 }
 
 // NewExpiringWithClock is like NewExpiring but allows passing in a custom
 // clock for testing.
-func NewExpiringWithClock(clock clock.Clock) *Expiring {
-	return &Expiring{
-		clock: clock,
-		cache: make(map[interface{}]entry),
+func NewExpiringWithClock(clock clock.Clock, opts ...ExpiringOption) *Expiring {
+	return NewExpiringCacheWithClock[interface{}, interface{}](clock, opts...)
+}
+
+// Expiring is a map whose entries expire after a per-entry timeout. It is
+// the untyped form of ExpiringCache.
+type Expiring = ExpiringCache[interface{}, interface{}]
+
+// NewExpiringCache returns an initialized typed expiring cache.
+func NewExpiringCache[K comparable, V any](opts ...ExpiringOption) *ExpiringCache[K, V] {
+	return NewExpiringCacheWithClock[K, V](clock.RealClock{}, opts...)
+}
+
+// NewExpiringCacheWithClock is like NewExpiringCache but allows passing in a
+// custom clock for testing.
+func NewExpiringCacheWithClock[K comparable, V any](clock clock.Clock, opts ...ExpiringOption) *ExpiringCache[K, V] {
+	options := buildExpiringOptions(opts)
+	return &ExpiringCache[K, V]{
+		clock:      clock,
+		onEvict:    evictFuncOf[K, V](options),
+		stats:      newStatsCounter(options.recorder),
+		sliding:    options.sliding,
+		maxEntries: options.maxEntries,
+		weigher:    weigherOf[K, V](options),
+		maxWeight:  options.maxWeight,
+		cache:      make(map[K]entry[K, V]),
+		wakeCh:     make(chan struct{}, 1),
 	}
 }
 
-// Expiring is a map whose entries expire after a per-entry timeout.
-type Expiring struct {
+// ExpiringCache is a map whose entries expire after a per-entry timeout.
+type ExpiringCache[K comparable, V any] struct {
 	clock clock.Clock
+	// onEvict is called for every entry which leaves the cache.
+	onEvict EvictFunc[K, V]
+	stats   *statsCounter
+	// sliding is true if reading an entry restarts its ttl.
+	sliding bool
+	// maxEntries is the maximum number of entries, 0 means no limit.
+	maxEntries int
+	// weigher is nil if the cache is not limited by weight.
+	weigher   Weigher[K, V]
+	maxWeight int64
 
 	// mu protects the below fields
 	mu sync.RWMutex
 	// cache is the internal map that backs the cache.
-	cache map[interface{}]entry
+	cache map[K]entry[K, V]
 	// generation is used as a cheap resource version for cache entries. Cleanups
 	// are scheduled with a key and generation. When the cleanup runs, it first
 	// compares its generation with the current generation of the entry. It
@@ -39,23 +73,94 @@ type Expiring struct {
 	//
 	// The integer value of the generation of an entry is meaningless.
 	generation uint64
+	// totalWeight is the sum of the weights of the entries.
+	totalWeight int64
+
+	heap expiringHeap[K]
 
-	heap expiringHeap
+	// wakeCh is signaled when Set pushes an entry which expires before every
+	// other entry in the heap, so that a running janitor can reschedule.
+	wakeCh chan struct{}
 }
 
-type entry struct {
-	val        interface{}
+type entry[K comparable, V any] struct {
+	val        V
 	expiry     time.Time
 	generation uint64
+	// ttl is the ttl the entry was set with.
+	ttl    time.Duration
+	weight int64
+	// cleanup is the heap entry scheduled for the current generation.
+	cleanup *expiringHeapEntry[K]
+}
+
+// Get looks up an entry in the cache. If the cache uses sliding expiration,
+// a successful Get restarts the ttl of the entry.
+func (c *ExpiringCache[K, V]) Get(key K) (val V, ok bool) {
+	now := c.clock.Now()
+	unlock := c.lockForRead()
+	defer unlock()
+	return c.getLocked(now, key)
+}
+
+// lockForRead locks the cache for a lookup and returns the matching unlock.
+// Lookups only need the read lock, unless they restart the ttl of the entry
+// they find.
+func (c *ExpiringCache[K, V]) lockForRead() (unlock func()) {
+	if c.sliding {
+		c.mu.Lock()
+		return c.mu.Unlock
+	}
+	c.mu.RLock()
+	return c.mu.RUnlock
+}
+
+// getLocked looks up an entry in the cache at now and counts the lookup.
+//
+// getLocked must be called under the lock taken by lockForRead.
+func (c *ExpiringCache[K, V]) getLocked(now time.Time, key K) (val V, ok bool) {
+	e, ok := c.cache[key]
+	if !ok {
+		c.stats.miss()
+		return val, false
+	}
+	if !now.Before(e.expiry) {
+		c.stats.expiredRead()
+		return val, false
+	}
+	if c.sliding {
+		c.slideLocked(now, key, e)
+	}
+	c.stats.hit()
+	return e.val, true
+}
+
+// slideLocked restarts the ttl of the entry of key. It moves the cleanup of
+// the entry in place rather than pushing another one, so that reading a key
+// over and over does not grow the heap.
+//
+// slideLocked must be called under the write lock.
+func (c *ExpiringCache[K, V]) slideLocked(now time.Time, key K, e entry[K, V]) {
+	c.generation++
+	e.expiry = now.Add(e.ttl)
+	e.generation = c.generation
+	if e.cleanup != nil && e.cleanup.index >= 0 {
+		e.cleanup.expiry = e.expiry
+		e.cleanup.generation = e.generation
+		heap.Fix(&c.heap, e.cleanup.index)
+	} else {
+		e.cleanup = c.schedule(key, e.expiry, e.generation)
+	}
+	c.cache[key] = e
 }
 
-// Get looks up an entry in the cache.
-func (c *Expiring) Get(key interface{}) (val interface{}, ok bool) {
+// peek is like Get but does not count towards the cache statistics.
+func (c *ExpiringCache[K, V]) peek(key K) (val V, ok bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	e, ok := c.cache[key]
 	if !ok || !c.clock.Now().Before(e.expiry) {
-		return nil, false
+		return val, false
 	}
 	return e.val, true
 }
@@ -65,65 +170,238 @@ func (c *Expiring) Get(key interface{}) (val interface{}, ok bool) {
 // may be lengthened or shortened by additional calls to Set(). Garbage
 // collection of expired entries occurs during calls to Set(), however calls to
 // Get() will not return expired entries that have not yet been garbage
-// collected.
-func (c *Expiring) Set(key interface{}, val interface{}, ttl time.Duration) {
+// collected. If the cache is limited in size, Set then evicts the entries
+// which expire soonest until the cache fits its limits. An entry heavier than
+// the weight limit on its own is dropped and reported as Evicted, and the
+// previous entry of key is left in place.
+func (c *ExpiringCache[K, V]) Set(key K, val V, ttl time.Duration) {
 	now := c.clock.Now()
-	expiry := now.Add(ttl)
+	c.setExpiry(now, key, val, now.Add(ttl), ttl)
+}
+
+// setExpiry is like Set but lets the entry expire at expiry rather than after
+// its ttl, which sliding expiration restarts on reads. The entry is weighed
+// before the lock is taken.
+func (c *ExpiringCache[K, V]) setExpiry(now time.Time, key K, val V, expiry time.Time, ttl time.Duration) {
+	weight, err := c.weigh(key, val)
+	if err != nil {
+		c.stats.evict(1)
+		if c.onEvict != nil {
+			c.onEvict(key, val, Evicted)
+		}
+		return
+	}
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	evicted := c.putLocked(now, key, val, weight, expiry, ttl)
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+}
+
+// putLocked sets the entry of key, which weighs weight, and garbage collects
+// the entries which expired at now. It returns the entries which must be
+// reported to the evict func once the lock is released.
+//
+// putLocked must be called under the write lock.
+func (c *ExpiringCache[K, V]) putLocked(now time.Time, key K, val V, weight int64, expiry time.Time, ttl time.Duration) []evictedEntry[K, V] {
+	var evicted []evictedEntry[K, V]
+	if old, ok := c.cache[key]; ok {
+		c.unscheduleLocked(old)
+		delete(c.cache, key)
+		c.totalWeight -= old.weight
+		if c.onEvict != nil {
+			reason := Replaced
+			if !now.Before(old.expiry) {
+				reason = Expired
+			}
+			evicted = append(evicted, evictedEntry[K, V]{key: key, value: old.val, reason: reason})
+		}
+	}
 
 	c.generation++
 
-	c.cache[key] = entry{
+	e := entry[K, V]{
 		val:        val,
 		expiry:     expiry,
 		generation: c.generation,
+		ttl:        ttl,
+		weight:     weight,
 	}
+	c.cache[key] = e
+	c.totalWeight += e.weight
 
 	// Run GC inline before pushing the new entry.
-	c.gc(now)
+	evicted = append(evicted, c.gc(now)...)
 
-	heap.Push(&c.heap, &expiringHeapEntry{
-		key:        key,
-		expiry:     expiry,
-		generation: c.generation,
-	})
+	e.cleanup = c.schedule(key, expiry, c.generation)
+	c.cache[key] = e
+	evicted = append(evicted, c.evictLocked()...)
+	if len(c.heap) > 0 && c.heap[0].generation == c.generation {
+		select {
+		case c.wakeCh <- struct{}{}:
+		default:
+		}
+	}
+	return evicted
 }
 
 // Delete deletes an entry in the map.
-func (c *Expiring) Delete(key interface{}) {
+func (c *ExpiringCache[K, V]) Delete(key K) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.del(key, 0)
+	e, ok := c.del(key, 0)
+	c.mu.Unlock()
+
+	if ok && c.onEvict != nil {
+		c.onEvict(key, e.val, Deleted)
+	}
 }
 
 // del deletes the entry for the given key. The generation argument is the
 // generation of the entry that should be deleted. If the generation has been
 // changed (e.g. if a set has occurred on an existing element but the old
 // cleanup still runs), this is a noop. If the generation argument is 0, the
-// entry's generation is ignored and the entry is deleted.
+// entry's generation is ignored and the entry is deleted. It returns the
+// deleted entry and whether an entry was deleted.
 //
 // del must be called under the write lock.
-func (c *Expiring) del(key interface{}, generation uint64) {
+func (c *ExpiringCache[K, V]) del(key K, generation uint64) (entry[K, V], bool) {
 	e, ok := c.cache[key]
 	if !ok {
-		return
+		return entry[K, V]{}, false
 	}
 	if generation != 0 && generation != e.generation {
-		return
+		return entry[K, V]{}, false
 	}
+	c.unscheduleLocked(e)
 	delete(c.cache, key)
+	c.totalWeight -= e.weight
+	return e, true
+}
+
+// unscheduleLocked removes the cleanup of e from the heap if it has not been
+// popped yet, so that the heap never holds more cleanups than the cache holds
+// entries.
+//
+// unscheduleLocked must be called under the write lock.
+func (c *ExpiringCache[K, V]) unscheduleLocked(e entry[K, V]) {
+	if e.cleanup != nil && e.cleanup.index >= 0 {
+		heap.Remove(&c.heap, e.cleanup.index)
+	}
+}
+
+// weigh returns the weight of an entry, or ErrEntryTooLarge if the entry alone
+// is heavier than the limit of the cache.
+func (c *ExpiringCache[K, V]) weigh(key K, val V) (int64, error) {
+	if c.weigher == nil {
+		return 0, nil
+	}
+	weight := c.weigher(key, val)
+	if weight > c.maxWeight {
+		return 0, ErrEntryTooLarge
+	}
+	return weight, nil
 }
 
 // Len returns the number of items in the cache.
-func (c *Expiring) Len() int {
+func (c *ExpiringCache[K, V]) Len() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return len(c.cache)
 }
 
-func (c *Expiring) gc(now time.Time) {
+// Stats returns a snapshot of the cache statistics.
+func (c *ExpiringCache[K, V]) Stats() Stats {
+	s := c.stats.snapshot()
+	c.mu.RLock()
+	s.Size = len(c.cache)
+	s.Weight = c.totalWeight
+	c.mu.RUnlock()
+	return s
+}
+
+// Run starts a janitor which garbage collects expired entries until stopCh is
+// closed. The janitor sleeps on a timer of the cache's clock until the next
+// entry expires, so expired entries are dropped even if Set is never called
+// again. Run blocks, it is usually started in its own goroutine.
+func (c *ExpiringCache[K, V]) Run(stopCh <-chan struct{}) {
+	var t clock.Timer
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+
+	for {
+		next, ok := c.purge()
+
+		var timerC <-chan time.Time
+		if ok {
+			d := next.Sub(c.clock.Now())
+			if t == nil {
+				t = c.clock.NewTimer(d)
+			} else {
+				t.Reset(d)
+			}
+			timerC = t.C()
+		} else if t != nil {
+			t.Stop()
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-c.wakeCh:
+		case <-timerC:
+		}
+	}
+}
+
+// RunWithContext is like Run but stops the janitor when ctx is done.
+func (c *ExpiringCache[K, V]) RunWithContext(ctx context.Context) {
+	c.Run(ctx.Done())
+}
+
+// purge garbage collects the expired entries and returns the expiry of the
+// next entry in the heap, if there is one.
+func (c *ExpiringCache[K, V]) purge() (next time.Time, ok bool) {
+	now := c.clock.Now()
+
+	c.mu.Lock()
+	evicted := c.gc(now)
+	if len(c.heap) > 0 {
+		next, ok = c.heap[0].expiry, true
+	}
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return next, ok
+}
+
+// schedule pushes a cleanup of the given generation of key onto the heap.
+//
+// schedule must be called under the write lock.
+func (c *ExpiringCache[K, V]) schedule(key K, expiry time.Time, generation uint64) *expiringHeapEntry[K] {
+	cleanup := &expiringHeapEntry[K]{
+		key:        key,
+		expiry:     expiry,
+		generation: generation,
+	}
+	heap.Push(&c.heap, cleanup)
+	return cleanup
+}
+
+// gc deletes all entries which expired at now. If the cache has an evict
+// function, the deleted entries are returned so that they can be reported
+// once the lock is released.
+//
+// gc must be called under the write lock.
+func (c *ExpiringCache[K, V]) gc(now time.Time) (evicted []evictedEntry[K, V]) {
+	purged := 0
+	defer func() {
+		c.stats.purge(purged)
+	}()
+
 	for {
 		// Return from gc if the heap is empty or the next element is not yet
 		// expired.
@@ -133,44 +411,93 @@ func (c *Expiring) gc(now time.Time) {
 		// heap.Pop() swaps the first entry with the last entry of the heap, then
 		// calls (*expiringHeap).Pop() which returns the last element.
 		if len(c.heap) == 0 || now.Before(c.heap[0].expiry) {
-			return
+			return evicted
+		}
+		cleanup := heap.Pop(&c.heap).(*expiringHeapEntry[K])
+		e, ok := c.del(cleanup.key, cleanup.generation)
+		if !ok {
+			continue
+		}
+		purged++
+		if c.onEvict != nil {
+			evicted = append(evicted, evictedEntry[K, V]{key: cleanup.key, value: e.val, reason: Expired})
+		}
+	}
+}
+
+// overflowLocked returns true if the cache holds more entries or more weight
+// than it may.
+//
+// overflowLocked must be called under the lock.
+func (c *ExpiringCache[K, V]) overflowLocked() bool {
+	if c.maxEntries > 0 && len(c.cache) > c.maxEntries {
+		return true
+	}
+	return c.weigher != nil && c.totalWeight > c.maxWeight
+}
+
+// evictLocked deletes the entries which expire soonest until the cache fits
+// its limits again. An entry which expires before every other entry may thus
+// be evicted by the Set which added it.
+//
+// evictLocked must be called under the write lock.
+func (c *ExpiringCache[K, V]) evictLocked() (evicted []evictedEntry[K, V]) {
+	n := 0
+	for len(c.heap) > 0 && c.overflowLocked() {
+		cleanup := heap.Pop(&c.heap).(*expiringHeapEntry[K])
+		e, ok := c.del(cleanup.key, cleanup.generation)
+		if !ok {
+			// A stale cleanup, the entry was set again or deleted.
+			continue
+		}
+		n++
+		if c.onEvict != nil {
+			evicted = append(evicted, evictedEntry[K, V]{key: cleanup.key, value: e.val, reason: Evicted})
 		}
-		cleanup := heap.Pop(&c.heap).(*expiringHeapEntry)
-		c.del(cleanup.key, cleanup.generation)
 	}
+	c.stats.evict(n)
+	return evicted
 }
 
-type expiringHeapEntry struct {
-	key        interface{}
+type expiringHeapEntry[K comparable] struct {
+	key        K
 	expiry     time.Time
 	generation uint64
+	// index is the position of the entry in the heap, or -1 once it has
+	// been popped.
+	index int
 }
 
 // expiringHeap is a min-heap ordered by expiration time of its entries. The
 // expiring cache uses this as a priority queue to efficiently organize entries
 // which will be garbage collected once they expire.
-type expiringHeap []*expiringHeapEntry
+type expiringHeap[K comparable] []*expiringHeapEntry[K]
 
-var _ heap.Interface = &expiringHeap{}
+var _ heap.Interface = &expiringHeap[interface{}]{}
 
-func (cq expiringHeap) Len() int {
+func (cq expiringHeap[K]) Len() int {
 	return len(cq)
 }
 
-func (cq expiringHeap) Less(i, j int) bool {
+func (cq expiringHeap[K]) Less(i, j int) bool {
 	return cq[i].expiry.Before(cq[j].expiry)
 }
 
-func (cq expiringHeap) Swap(i, j int) {
+func (cq expiringHeap[K]) Swap(i, j int) {
 	cq[i], cq[j] = cq[j], cq[i]
+	cq[i].index = i
+	cq[j].index = j
 }
 
-func (cq *expiringHeap) Push(c interface{}) {
-	*cq = append(*cq, c.(*expiringHeapEntry))
+func (cq *expiringHeap[K]) Push(c interface{}) {
+	e := c.(*expiringHeapEntry[K])
+	e.index = cq.Len()
+	*cq = append(*cq, e)
 }
 
-func (cq *expiringHeap) Pop() interface{} {
+func (cq *expiringHeap[K]) Pop() interface{} {
 	c := (*cq)[cq.Len()-1]
+	c.index = -1
 	*cq = (*cq)[:cq.Len()-1]
 	return c
 }
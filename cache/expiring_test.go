@@ -17,13 +17,17 @@ limitations under the License.
 package cache
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"math/rand"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/x893675/gopkg/clock"
+	"github.com/x893675/gopkg/wait"
 
 	"github.com/google/uuid"
 )
@@ -289,3 +293,339 @@ func TestStressExpiringCache(t *testing.T) {
 		t.Errorf("unexpected cache size: got=%d, want=1", cache.Len())
 	}
 }
+
+type evictRecord struct {
+	key, value interface{}
+	reason     EvictReason
+}
+
+type evictRecorder struct {
+	mu      sync.Mutex
+	records []evictRecord
+}
+
+func (r *evictRecorder) onEvict(key, value interface{}, reason EvictReason) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, evictRecord{key, value, reason})
+}
+
+func (r *evictRecorder) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.records)
+}
+
+func (r *evictRecorder) take() []evictRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	records := r.records
+	r.records = nil
+	return records
+}
+
+func expectEvicted(t *testing.T, r *evictRecorder, want ...evictRecord) {
+	t.Helper()
+	got := r.take()
+	if len(got) != len(want) {
+		t.Fatalf("unexpected evictions: got=%v, want=%v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("unexpected eviction %d: got=%v, want=%v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExpiringEvictFunc(t *testing.T) {
+	fc := &clock.FakeClock{}
+	r := &evictRecorder{}
+	c := NewExpiringWithClock(fc, WithEvictFunc(r.onEvict))
+
+	c.Set("a", "a1", time.Second)
+	expectEvicted(t, r)
+
+	c.Set("a", "a2", time.Second)
+	expectEvicted(t, r, evictRecord{"a", "a1", Replaced})
+
+	c.Delete("a")
+	expectEvicted(t, r, evictRecord{"a", "a2", Deleted})
+
+	c.Delete("a")
+	expectEvicted(t, r)
+
+	c.Set("b", "b", time.Second)
+	fc.Step(time.Second)
+	c.Set("c", "c", time.Second)
+	expectEvicted(t, r, evictRecord{"b", "b", Expired})
+
+	fc.Step(time.Second)
+	c.Set("c", "c2", time.Second)
+	expectEvicted(t, r, evictRecord{"c", "c", Expired})
+}
+
+func TestExpiringEvictFuncMayCallCache(t *testing.T) {
+	var c *Expiring
+	c = NewExpiring(WithEvictFunc(func(key, value interface{}, reason EvictReason) {
+		c.Len()
+	}))
+	c.Set("a", "a", time.Hour)
+	c.Set("a", "a", time.Hour)
+	c.Delete("a")
+}
+
+func TestExpiringJanitor(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	r := &evictRecorder{}
+	c := NewExpiringWithClock(fc, WithEvictFunc(r.onEvict))
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(stopCh)
+	}()
+
+	waitFor := func(desc string, condition func() bool) {
+		t.Helper()
+		err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+			return condition(), nil
+		})
+		if err != nil {
+			t.Fatalf("timed out waiting for %s", desc)
+		}
+	}
+
+	c.Set("a", "a", time.Second)
+	c.Set("b", "b", 2*time.Second)
+	waitFor("janitor timer", fc.HasWaiters)
+
+	fc.Step(time.Second)
+	waitFor("first purge", func() bool { return r.len() == 1 })
+	expectEvicted(t, r, evictRecord{"a", "a", Expired})
+
+	fc.Step(time.Second)
+	waitFor("second purge", func() bool { return r.len() == 1 })
+	expectEvicted(t, r, evictRecord{"b", "b", Expired})
+	if got := c.Len(); got != 0 {
+		t.Errorf("unexpected cache size: got=%d, want=0", got)
+	}
+
+	// With nothing left to expire the janitor must not hold a timer.
+	waitFor("janitor to go idle", func() bool { return !fc.HasWaiters() })
+
+	// A new entry wakes the idle janitor up again.
+	c.Set("c", "c", time.Second)
+	waitFor("janitor timer", fc.HasWaiters)
+	fc.Step(time.Second)
+	waitFor("third purge", func() bool { return c.Len() == 0 })
+
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("janitor did not stop")
+	}
+}
+
+func TestTypedExpiringCache(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	var evicted []string
+	c := NewExpiringCacheWithClock[string, int](fc, WithEvictFunc(func(key string, value int, reason EvictReason) {
+		evicted = append(evicted, fmt.Sprintf("%s=%d:%v", key, value, reason))
+	}))
+
+	if v, ok := c.Get("a"); ok || v != 0 {
+		t.Errorf("Expected 0, false, got %d, %v", v, ok)
+	}
+	c.Set("a", 1, time.Second)
+	c.Set("a", 2, time.Second)
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Expected 2, true, got %d, %v", v, ok)
+	}
+	fc.Step(time.Second)
+	c.Set("b", 3, time.Second)
+
+	want := []string{"a=1:Replaced", "a=2:Expired"}
+	if !reflect.DeepEqual(evicted, want) {
+		t.Errorf("unexpected evictions: got=%v, want=%v", evicted, want)
+	}
+}
+
+func TestEvictFuncTypeMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a mismatched evict func")
+		}
+	}()
+	NewExpiringCache[string, int](WithEvictFunc(func(key, value interface{}, reason EvictReason) {}))
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewExpiringCacheWithClock[string, int](fc, WithSlidingExpiration())
+	c.Set("a", 1, time.Second)
+
+	// Every read restarts the ttl, so the entry outlives its original expiry.
+	for i := 0; i < 10; i++ {
+		fc.Step(500 * time.Millisecond)
+		if _, ok := c.Get("a"); !ok {
+			t.Fatalf("expected entry to be alive after %d reads", i)
+		}
+	}
+	if got := len(c.heap); got != 1 {
+		t.Errorf("unexpected heap size: got=%d, want=1", got)
+	}
+
+	// gc only drops the entry once it has been idle for a full ttl.
+	fc.Step(999 * time.Millisecond)
+	c.Set("b", 2, time.Hour)
+	if _, ok := c.peek("a"); !ok {
+		t.Errorf("expected entry to survive gc")
+	}
+	fc.Step(time.Millisecond)
+	c.Set("b", 2, time.Hour)
+	if _, ok := c.peek("a"); ok {
+		t.Errorf("expected entry to be collected")
+	}
+	if got := c.Len(); got != 1 {
+		t.Errorf("unexpected cache size: got=%d, want=1", got)
+	}
+}
+
+func TestSlidingExpirationAfterReplace(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewExpiringCacheWithClock[string, int](fc, WithSlidingExpiration())
+	c.Set("a", 1, time.Second)
+	c.Set("a", 2, time.Minute)
+
+	// The read moves the cleanup of the current generation, the stale one of
+	// the first Set must not delete the entry.
+	fc.Step(30 * time.Second)
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Fatalf("Expected 2, true, got %d, %v", v, ok)
+	}
+	fc.Step(59 * time.Second)
+	c.Set("b", 3, time.Hour)
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Errorf("Expected 2, true, got %d, %v", v, ok)
+	}
+}
+
+func TestExpiringMaxEntries(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	r := &evictRecorder{}
+	c := NewExpiringWithClock(fc, WithMaxEntries(2), WithEvictFunc(r.onEvict))
+
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Second)
+	// Setting a again leaves a stale cleanup in the heap, which must be
+	// skipped when looking for the entry to evict.
+	c.Set("a", 3, time.Hour)
+	c.Set("c", 4, time.Minute)
+	expectEvicted(t, r, evictRecord{"a", 1, Replaced}, evictRecord{"b", 2, Evicted})
+
+	c.Set("d", 5, time.Second)
+	expectEvicted(t, r, evictRecord{"d", 5, Evicted})
+
+	if got := c.Len(); got != 2 {
+		t.Errorf("unexpected cache size: got=%d, want=2", got)
+	}
+	if got := c.Stats().Evictions; got != 2 {
+		t.Errorf("unexpected evictions: got=%d, want=2", got)
+	}
+}
+
+func TestExpiringMaxWeight(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	r := &evictRecorder{}
+	c := NewExpiringCacheWithClock[string, string](fc,
+		WithWeigher(10, func(key, value string) int64 { return int64(len(value)) }),
+		WithEvictFunc(func(key, value string, reason EvictReason) { r.onEvict(key, value, reason) }))
+
+	c.Set("a", "12345", time.Second)
+	c.Set("b", "12345", time.Minute)
+	c.Set("c", "1234", time.Hour)
+	expectEvicted(t, r, evictRecord{"a", "12345", Evicted})
+	if got := c.Stats().Weight; got != 9 {
+		t.Errorf("unexpected weight: got=%d, want=9", got)
+	}
+
+	// An entry over the limit is dropped and the cache is left alone.
+	c.Set("d", "12345678901", time.Hour)
+	expectEvicted(t, r, evictRecord{"d", "12345678901", Evicted})
+	if got := c.Len(); got != 2 {
+		t.Errorf("unexpected cache size: got=%d, want=2", got)
+	}
+}
+
+func TestExpiringMaxBytes(t *testing.T) {
+	c := NewExpiringCache[int, []byte](WithMaxBytes(10 * 1024))
+	for i := 0; i < 100; i++ {
+		c.Set(i, make([]byte, 1024), time.Duration(i+1)*time.Minute)
+	}
+	s := c.Stats()
+	if s.Weight > 10*1024 || s.Size >= 10 {
+		t.Errorf("expected the cache to stay under its budget, got %+v", s)
+	}
+	if s.Evictions == 0 {
+		t.Errorf("expected evictions")
+	}
+	// The entries which expire last survive.
+	if _, ok := c.Get(99); !ok {
+		t.Errorf("expected the newest entry to be kept")
+	}
+}
+
+func TestExpiringHeapBoundedByEntries(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewExpiringCacheWithClock[string, int](fc, WithMaxEntries(2))
+
+	// Replacing a key drops the cleanup of the replaced entry.
+	for i := 0; i < 100; i++ {
+		c.Set("a", i, time.Hour)
+	}
+	c.Set("b", 1, time.Hour)
+	if got := len(c.heap); got != 2 {
+		t.Errorf("unexpected heap size after replacements: got=%d, want=2", got)
+	}
+
+	c.Delete("a")
+	c.DeleteFunc(func(key string, value int) bool { return key == "b" })
+	if got := len(c.heap); got != 0 {
+		t.Errorf("unexpected heap size after deletes: got=%d, want=0", got)
+	}
+
+	c.Set("c", 1, time.Hour)
+	c.Update("c", func(old int, found bool) (int, time.Duration, bool) {
+		return 0, 0, false
+	})
+	if got := len(c.heap); got != 0 {
+		t.Errorf("unexpected heap size after update: got=%d, want=0", got)
+	}
+}
+
+func TestExpiringWeighsWithoutLock(t *testing.T) {
+	var c *ExpiringCache[string, string]
+	// The weigher reads the cache, which would deadlock if it ran under the
+	// write lock.
+	c = NewExpiringCache[string, string](WithWeigher(10, func(key, value string) int64 {
+		c.Len()
+		return int64(len(value))
+	}))
+
+	c.Set("a", "1", time.Hour)
+	if err := c.SetMany(map[string]string{"b": "12"}, time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := c.Snapshot(&buf, GobCodec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Restore(&buf, GobCodec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := c.Stats().Weight; got != 3 {
+		t.Errorf("unexpected weight: got=%d, want=3", got)
+	}
+}
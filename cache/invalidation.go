@@ -0,0 +1,339 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/x893675/gopkg/rand"
+	"github.com/x893675/gopkg/wait"
+)
+
+// ErrInvalidatorClosed is returned by Publish once the Invalidator is closed.
+var ErrInvalidatorClosed = errors.New("cache: invalidator is closed")
+
+// Invalidator broadcasts key invalidations between the replicas of a service,
+// so that a replica which changed a record can make the others drop their
+// cached copy of it. An Invalidator does not receive its own invalidations.
+type Invalidator interface {
+	// Publish broadcasts an invalidation of keys to the other replicas.
+	Publish(keys ...string) error
+	// Subscribe calls f with the keys of every invalidation received from
+	// the other replicas, until the returned func is called. f is called
+	// from a single goroutine of the Invalidator, one invalidation at a time.
+	Subscribe(f func(keys []string)) (unsubscribe func())
+	// Close stops the Invalidator and releases its resources.
+	Close() error
+}
+
+// SubscribeLRUCache removes the keys invalidated through inv from c until the
+// returned func is called.
+func SubscribeLRUCache[V any](inv Invalidator, c *LRUCache[string, V]) (unsubscribe func()) {
+	return subscribeCache(inv, c.Remove)
+}
+
+// SubscribeLRUExpireCache is like SubscribeLRUCache for an untyped cache, whose
+// keys are removed as strings.
+func SubscribeLRUExpireCache(inv Invalidator, c *LRUExpireCache) (unsubscribe func()) {
+	return subscribeCache(inv, func(key string) { c.Remove(key) })
+}
+
+// SubscribeExpiringCache removes the keys invalidated through inv from c until
+// the returned func is called.
+func SubscribeExpiringCache[V any](inv Invalidator, c *ExpiringCache[string, V]) (unsubscribe func()) {
+	return subscribeCache(inv, c.Delete)
+}
+
+// SubscribeExpiring is like SubscribeExpiringCache for an untyped cache, whose
+// keys are deleted as strings.
+func SubscribeExpiring(inv Invalidator, c *Expiring) (unsubscribe func()) {
+	return subscribeCache(inv, func(key string) { c.Delete(key) })
+}
+
+func subscribeCache(inv Invalidator, remove func(key string)) func() {
+	return inv.Subscribe(func(keys []string) {
+		for _, key := range keys {
+			remove(key)
+		}
+	})
+}
+
+// subscribers holds the funcs subscribed to an Invalidator.
+type subscribers struct {
+	mu     sync.Mutex
+	nextID int
+	funcs  map[int]func(keys []string)
+}
+
+func (s *subscribers) add(f func(keys []string)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.funcs == nil {
+		s.funcs = make(map[int]func(keys []string))
+	}
+	id := s.nextID
+	s.nextID++
+	s.funcs[id] = f
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.funcs, id)
+	}
+}
+
+// notify calls every subscribed func with keys. The funcs are called without
+// the lock, so they may subscribe or unsubscribe.
+func (s *subscribers) notify(keys []string) {
+	s.mu.Lock()
+	funcs := make([]func(keys []string), 0, len(s.funcs))
+	for _, f := range s.funcs {
+		funcs = append(funcs, f)
+	}
+	s.mu.Unlock()
+
+	for _, f := range funcs {
+		f(keys)
+	}
+}
+
+// ChannelBus connects in-process Invalidators with channels. It stands in for
+// a network transport in tests and in programs which run several replicas in
+// one process.
+type ChannelBus struct {
+	mu      sync.Mutex
+	members map[*channelInvalidator]struct{}
+}
+
+// NewChannelBus returns a ChannelBus without members.
+func NewChannelBus() *ChannelBus {
+	return &ChannelBus{members: make(map[*channelInvalidator]struct{})}
+}
+
+// Join returns a new Invalidator which receives the invalidations published
+// by the other members of the bus.
+func (b *ChannelBus) Join() Invalidator {
+	inv := &channelInvalidator{
+		bus:    b,
+		ch:     make(chan []string, 64),
+		stopCh: make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.members[inv] = struct{}{}
+	b.mu.Unlock()
+
+	go inv.run()
+	return inv
+}
+
+func (b *ChannelBus) leave(inv *channelInvalidator) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.members, inv)
+}
+
+// others returns the members of the bus other than inv.
+func (b *ChannelBus) others(inv *channelInvalidator) []*channelInvalidator {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	others := make([]*channelInvalidator, 0, len(b.members))
+	for m := range b.members {
+		if m != inv {
+			others = append(others, m)
+		}
+	}
+	return others
+}
+
+type channelInvalidator struct {
+	bus  *ChannelBus
+	subs subscribers
+	// ch receives the invalidations published by the other members.
+	ch        chan []string
+	stopCh    chan struct{}
+	closeOnce sync.Once
+}
+
+func (inv *channelInvalidator) run() {
+	for {
+		select {
+		case keys := <-inv.ch:
+			inv.subs.notify(keys)
+		case <-inv.stopCh:
+			return
+		}
+	}
+}
+
+// Publish hands keys to every other member of the bus. It blocks while the
+// channel of a member is full.
+func (inv *channelInvalidator) Publish(keys ...string) error {
+	select {
+	case <-inv.stopCh:
+		return ErrInvalidatorClosed
+	default:
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	keys = append([]string(nil), keys...)
+	for _, m := range inv.bus.others(inv) {
+		select {
+		case m.ch <- keys:
+		case <-m.stopCh:
+		}
+	}
+	return nil
+}
+
+func (inv *channelInvalidator) Subscribe(f func(keys []string)) func() {
+	return inv.subs.add(f)
+}
+
+func (inv *channelInvalidator) Close() error {
+	inv.closeOnce.Do(func() {
+		inv.bus.leave(inv)
+		close(inv.stopCh)
+	})
+	return nil
+}
+
+// maxPacketSize is the largest invalidation packet a MulticastInvalidator
+// sends, it keeps packets within the MTU of common networks.
+const maxPacketSize = 1400
+
+// invalidationPacket is the payload of a multicast invalidation.
+type invalidationPacket struct {
+	// Sender identifies the Invalidator which sent the packet, so that it
+	// can ignore its own packets when multicast loopback is on.
+	Sender string
+	Keys   []string
+}
+
+// MulticastInvalidator broadcasts invalidations with UDP multicast. Delivery
+// is best effort: packets may be lost, so the caches it invalidates should
+// still use a ttl.
+type MulticastInvalidator struct {
+	id     string
+	conn   *net.UDPConn
+	sender *net.UDPConn
+	subs   subscribers
+	// stopCh is closed by Close, it interrupts the backoff after a failed
+	// read.
+	stopCh chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+var _ Invalidator = &MulticastInvalidator{}
+
+// NewMulticastInvalidator joins the multicast group, an address such as
+// "239.255.0.1:7946", on the network interface ifi. If ifi is nil, the system
+// picks the interface. Invalidations are sent along the route of the group.
+func NewMulticastInvalidator(group string, ifi *net.Interface) (*MulticastInvalidator, error) {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", ifi, addr)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	inv := &MulticastInvalidator{
+		id:     rand.String(16),
+		conn:   conn,
+		sender: sender,
+		stopCh: make(chan struct{}),
+	}
+	go inv.run()
+	return inv, nil
+}
+
+// multicastReadBackoff is the backoff between failed reads of a
+// MulticastInvalidator, so that a persistent socket error does not spin.
+var multicastReadBackoff = wait.Backoff{
+	Duration: 10 * time.Millisecond,
+	Factor:   2,
+	Steps:    8,
+	Cap:      time.Second,
+}
+
+func (inv *MulticastInvalidator) run() {
+	buf := make([]byte, 64*1024)
+	backoff := multicastReadBackoff
+	for {
+		n, _, err := inv.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			select {
+			case <-time.After(backoff.Step()):
+			case <-inv.stopCh:
+				return
+			}
+			continue
+		}
+		backoff = multicastReadBackoff
+		var p invalidationPacket
+		if err := json.Unmarshal(buf[:n], &p); err != nil || p.Sender == inv.id {
+			continue
+		}
+		inv.subs.notify(p.Keys)
+	}
+}
+
+// Publish sends keys to the group, split over as many packets as needed.
+func (inv *MulticastInvalidator) Publish(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(invalidationPacket{Sender: inv.id, Keys: keys})
+	if err != nil {
+		return err
+	}
+	if len(data) > maxPacketSize {
+		if len(keys) == 1 {
+			return fmt.Errorf("cache: key of %d bytes does not fit in an invalidation packet", len(keys[0]))
+		}
+		half := len(keys) / 2
+		if err := inv.Publish(keys[:half]...); err != nil {
+			return err
+		}
+		return inv.Publish(keys[half:]...)
+	}
+	if _, err := inv.sender.Write(data); err != nil {
+		if errors.Is(err, net.ErrClosed) {
+			return ErrInvalidatorClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// Subscribe implements Invalidator.
+func (inv *MulticastInvalidator) Subscribe(f func(keys []string)) func() {
+	return inv.subs.add(f)
+}
+
+// Close leaves the group.
+func (inv *MulticastInvalidator) Close() error {
+	inv.closeOnce.Do(func() {
+		close(inv.stopCh)
+		inv.closeErr = inv.conn.Close()
+		if err := inv.sender.Close(); inv.closeErr == nil {
+			inv.closeErr = err
+		}
+	})
+	return inv.closeErr
+}
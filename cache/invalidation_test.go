@@ -0,0 +1,154 @@
+package cache
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/wait"
+)
+
+// keyCollector records the keys of the invalidations it receives.
+type keyCollector struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (c *keyCollector) add(keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = append(c.keys, keys...)
+}
+
+func (c *keyCollector) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.keys)
+}
+
+func TestChannelBus(t *testing.T) {
+	bus := NewChannelBus()
+	a, b := bus.Join(), bus.Join()
+	defer b.Close()
+
+	c := NewLRUExpireCache(10)
+	c.Add("user/1", 1, time.Hour)
+	c.Add("user/2", 2, time.Hour)
+	SubscribeLRUExpireCache(b, c)
+
+	var own keyCollector
+	a.Subscribe(own.add)
+
+	if err := a.Publish("user/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return c.Len() == 1, nil
+	})
+	if err != nil {
+		t.Fatalf("expected user/1 to be invalidated")
+	}
+	expectEntry(t, c, "user/2", 2)
+	if own.len() != 0 {
+		t.Errorf("expected the publisher not to receive its own invalidation")
+	}
+
+	a.Close()
+	if err := a.Publish("user/2"); err != ErrInvalidatorClosed {
+		t.Errorf("expected ErrInvalidatorClosed, got %v", err)
+	}
+}
+
+func TestSubscribeExpiringCache(t *testing.T) {
+	bus := NewChannelBus()
+	a, b := bus.Join(), bus.Join()
+	defer a.Close()
+	defer b.Close()
+
+	c := NewExpiringCache[string, int]()
+	c.Set("user/1", 1, time.Hour)
+	unsubscribe := SubscribeExpiringCache(b, c)
+	defer unsubscribe()
+
+	if err := a.Publish("user/1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return c.Len() == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("expected user/1 to be invalidated")
+	}
+}
+
+// multicastAvailable checks that a packet sent to group is looped back to a
+// listener on this host.
+func multicastAvailable(group string) bool {
+	addr, err := net.ResolveUDPAddr("udp4", group)
+	if err != nil {
+		return false
+	}
+	l, err := net.ListenMulticastUDP("udp4", nil, addr)
+	if err != nil {
+		return false
+	}
+	defer l.Close()
+	s, err := net.DialUDP("udp4", nil, addr)
+	if err != nil {
+		return false
+	}
+	defer s.Close()
+	if _, err := s.Write([]byte("probe")); err != nil {
+		return false
+	}
+	l.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = l.ReadFromUDP(make([]byte, 16))
+	return err == nil
+}
+
+func TestMulticastInvalidator(t *testing.T) {
+	const group = "239.255.90.17:17946"
+	if !multicastAvailable(group) {
+		t.Skip("multicast loopback is not available")
+	}
+
+	a, err := NewMulticastInvalidator(group, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+	b, err := NewMulticastInvalidator(group, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Close()
+
+	var own, received keyCollector
+	a.Subscribe(own.add)
+	b.Subscribe(received.add)
+
+	// Enough keys to be split over several packets.
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("tenant/%d/%s", i, strings.Repeat("x", 20))
+	}
+	if err := a.Publish(keys...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = wait.PollImmediate(10*time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return received.len() == len(keys), nil
+	})
+	if err != nil {
+		t.Fatalf("received %d of %d keys", received.len(), len(keys))
+	}
+	if own.len() != 0 {
+		t.Errorf("expected the publisher not to receive its own invalidation")
+	}
+
+	if err := a.Publish(strings.Repeat("x", maxPacketSize)); err == nil {
+		t.Errorf("expected an error for an oversized key")
+	}
+}
@@ -0,0 +1,309 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+	"github.com/x893675/gopkg/runtime"
+	"github.com/x893675/gopkg/wait"
+)
+
+// LoaderFunc loads the value for a key which is missing from a LoadingCache.
+type LoaderFunc func(ctx context.Context, key interface{}) (interface{}, error)
+
+// LoadingCache puts a loader in front of an Expiring or an LRUExpireCache.
+// Concurrent misses for the same key are de-duplicated, so the loader runs
+// once and every waiter receives its result.
+type LoadingCache struct {
+	backend loadingBackend
+	ttl     time.Duration
+	clock   clock.Clock
+	// stats counts the loads, the other statistics come from the backend.
+	stats *statsCounter
+
+	// errs holds the errors of failed loads for negativeTTL, it is nil
+	// if failed loads are not cached.
+	errs        *Expiring
+	negativeTTL time.Duration
+
+	// fresh holds the keys whose value was loaded less than refreshAfter
+	// ago, it is nil if stale-while-revalidate is off.
+	fresh             *Expiring
+	refreshAfter      time.Duration
+	refreshBackoff    time.Duration
+	refreshMaxBackoff time.Duration
+
+	// mu protects the below fields
+	mu    sync.Mutex
+	calls map[interface{}]*loadCall
+	// refreshing holds the keys with a running background refresh.
+	refreshing map[interface{}]struct{}
+}
+
+// loadingBackend is the cache which holds the values of a LoadingCache.
+type loadingBackend interface {
+	get(key interface{}) (interface{}, bool)
+	// peek is like get but leaves statistics and recency untouched.
+	peek(key interface{}) (interface{}, bool)
+	set(key interface{}, value interface{}, ttl time.Duration)
+	stats() Stats
+}
+
+type expiringBackend struct{ c *Expiring }
+
+func (b expiringBackend) get(key interface{}) (interface{}, bool)  { return b.c.Get(key) }
+func (b expiringBackend) peek(key interface{}) (interface{}, bool) { return b.c.peek(key) }
+func (b expiringBackend) set(key interface{}, value interface{}, ttl time.Duration) {
+	b.c.Set(key, value, ttl)
+}
+func (b expiringBackend) stats() Stats { return b.c.Stats() }
+
+type lruBackend struct{ c *LRUExpireCache }
+
+func (b lruBackend) get(key interface{}) (interface{}, bool)  { return b.c.Get(key) }
+func (b lruBackend) peek(key interface{}) (interface{}, bool) { return b.c.peek(key) }
+func (b lruBackend) set(key interface{}, value interface{}, ttl time.Duration) {
+	b.c.Add(key, value, ttl)
+}
+func (b lruBackend) stats() Stats { return b.c.Stats() }
+
+// loadCall is an in-flight or completed load of a single key.
+type loadCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// NewLoadingCache returns a LoadingCache which stores loaded values in c for
+// ttl.
+func NewLoadingCache(c *Expiring, ttl time.Duration, opts ...LoadingOption) *LoadingCache {
+	return newLoadingCache(expiringBackend{c}, c.clock, ttl, opts...)
+}
+
+// NewLRULoadingCache returns a LoadingCache which stores loaded values in c
+// for ttl. If the clock of c is a clock.Clock it is also used for the
+// negative ttl and refreshes, otherwise the real clock is used.
+func NewLRULoadingCache(c *LRUExpireCache, ttl time.Duration, opts ...LoadingOption) *LoadingCache {
+	return newLoadingCache(lruBackend{c}, asClock(c.clock), ttl, opts...)
+}
+
+func newLoadingCache(backend loadingBackend, clock clock.Clock, ttl time.Duration, opts ...LoadingOption) *LoadingCache {
+	options := buildLoadingOptions(opts)
+	c := &LoadingCache{
+		backend:           backend,
+		ttl:               ttl,
+		clock:             clock,
+		stats:             newStatsCounter(options.recorder),
+		negativeTTL:       options.negativeTTL,
+		refreshAfter:      options.refreshAfter,
+		refreshBackoff:    options.refreshBackoff,
+		refreshMaxBackoff: options.refreshMaxBackoff,
+		calls:             make(map[interface{}]*loadCall),
+		refreshing:        make(map[interface{}]struct{}),
+	}
+	if c.negativeTTL > 0 {
+		c.errs = NewExpiringWithClock(clock)
+	}
+	if c.refreshAfter > 0 {
+		c.fresh = NewExpiringWithClock(clock)
+	}
+	return c
+}
+
+// Get returns the cached value for key without loading it. A stale value is
+// returned as is, Get never starts a refresh.
+func (c *LoadingCache) Get(key interface{}) (interface{}, bool) {
+	return c.backend.get(key)
+}
+
+// Stats returns the statistics of the underlying cache together with the
+// load counters of c.
+func (c *LoadingCache) Stats() Stats {
+	s := c.backend.stats()
+	l := c.stats.snapshot()
+	s.Loads, s.LoadErrors, s.LoadTime = l.Loads, l.LoadErrors, l.LoadTime
+	return s
+}
+
+// GetOrLoad returns the cached value for key. On a miss it calls loader and
+// caches the result. If a load for the key is already in flight, GetOrLoad
+// waits for it and returns its result instead of calling loader again.
+//
+// If the cache refreshes stale values, a stale hit is returned right away and
+// loader is called again in the background to replace it.
+//
+// The loader runs in its own goroutine with a context which carries the values
+// of the context of the caller which started the load, but is never canceled,
+// so that a single caller giving up does not fail the load for everyone.
+// Callers stop waiting and return ctx.Err() when their own ctx is done, the
+// load itself carries on. If loader panics, every waiter gets an error
+// instead; the panic is neither propagated nor cached.
+func (c *LoadingCache) GetOrLoad(ctx context.Context, key interface{}, loader LoaderFunc) (interface{}, error) {
+	if v, ok := c.backend.get(key); ok {
+		if c.fresh != nil {
+			if _, fresh := c.fresh.Get(key); !fresh {
+				c.refresh(ctx, key, loader)
+			}
+		}
+		return v, nil
+	}
+	if c.errs != nil {
+		if err, ok := c.errs.Get(key); ok {
+			return nil, err.(error)
+		}
+	}
+
+	c.mu.Lock()
+	// A load may have completed since the lookup above.
+	if v, ok := c.backend.peek(key); ok {
+		c.mu.Unlock()
+		return v, nil
+	}
+	call, inflight := c.calls[key]
+	if !inflight {
+		call = &loadCall{done: make(chan struct{})}
+		c.calls[key] = call
+	}
+	c.mu.Unlock()
+
+	if !inflight {
+		go c.load(detachedContext{ctx}, key, call, loader)
+	}
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// load runs loader for key and publishes its result through call. A panic of
+// loader is returned to the waiters as an error, as nothing could recover it
+// in the goroutine of the load.
+func (c *LoadingCache) load(ctx context.Context, key interface{}, call *loadCall, loader LoaderFunc) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.value, call.err = nil, loaderPanicked(key, r)
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = c.callLoader(ctx, key, loader)
+	if call.err != nil {
+		// A canceled or timed out call says nothing about the key, it is
+		// not cached.
+		if c.errs != nil && !isContextError(call.err) {
+			c.errs.Set(key, call.err, c.negativeTTL)
+		}
+		return
+	}
+	c.store(key, call.value)
+}
+
+// loaderPanicked reports the panic r of the loader of key to the
+// runtime.PanicHandlers and returns it as an error.
+func loaderPanicked(key interface{}, r interface{}) error {
+	for _, fn := range runtime.PanicHandlers {
+		fn(r)
+	}
+	return fmt.Errorf("cache: loader for key %v panicked: %v", key, r)
+}
+
+// isContextError reports whether err is or wraps a context error.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// detachedContext carries the values of its parent but is never canceled.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+// callLoader calls loader and records its latency.
+func (c *LoadingCache) callLoader(ctx context.Context, key interface{}, loader LoaderFunc) (interface{}, error) {
+	start := c.clock.Now()
+	value, err := loader(ctx, key)
+	c.stats.load(c.clock.Since(start), err)
+	return value, err
+}
+
+// store caches a freshly loaded value.
+func (c *LoadingCache) store(key interface{}, value interface{}) {
+	c.backend.set(key, value, c.ttl)
+	if c.fresh != nil {
+		c.fresh.Set(key, struct{}{}, c.refreshAfter)
+	}
+}
+
+// refresh starts a background refresh of key unless the key is already
+// being refreshed or loaded. As for load, the loader gets the values of ctx
+// but is not canceled with it.
+func (c *LoadingCache) refresh(ctx context.Context, key interface{}, loader LoaderFunc) {
+	c.mu.Lock()
+	_, refreshing := c.refreshing[key]
+	_, loading := c.calls[key]
+	if refreshing || loading {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		c.runRefresh(detachedContext{ctx}, key, loader)
+	}()
+}
+
+// runRefresh calls loader until it succeeds, backing off exponentially on
+// the cache's clock between failures. It gives up once the stale value has
+// reached its hard ttl and left the cache. A panic of loader counts as a
+// failure.
+func (c *LoadingCache) runRefresh(ctx context.Context, key interface{}, loader LoaderFunc) {
+	stopCh := make(chan struct{})
+	backoff := wait.NewExponentialBackoffManager(c.refreshBackoff, c.refreshMaxBackoff, c.ttl, 2.0, 0, c.clock)
+	wait.BackoffUntil(func() {
+		if _, ok := c.backend.peek(key); !ok {
+			close(stopCh)
+			return
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				loaderPanicked(key, r)
+			}
+		}()
+		value, err := c.callLoader(ctx, key, loader)
+		if err != nil {
+			return
+		}
+		c.store(key, value)
+		close(stopCh)
+	}, backoff, true, stopCh)
+}
+
+// asClock returns c if it is a clock.Clock and the real clock otherwise.
+func asClock(c Clock) clock.Clock {
+	if cc, ok := c.(clock.Clock); ok {
+		return cc
+	}
+	return clock.RealClock{}
+}
@@ -0,0 +1,374 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+	"github.com/x893675/gopkg/wait"
+)
+
+func TestLoadingCacheLoadsOnce(t *testing.T) {
+	for name, c := range map[string]*LoadingCache{
+		"expiring": NewLoadingCache(NewExpiring(), time.Hour),
+		"lru":      NewLRULoadingCache(NewLRUExpireCache(10), time.Hour),
+	} {
+		t.Run(name, func(t *testing.T) {
+			var calls int32
+			release := make(chan struct{})
+			loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			}
+
+			const waiters = 50
+			var started, wg sync.WaitGroup
+			results := make(chan interface{}, waiters)
+			for i := 0; i < waiters; i++ {
+				started.Add(1)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					started.Done()
+					v, err := c.GetOrLoad(context.Background(), "key", loader)
+					if err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+					results <- v
+				}()
+			}
+			started.Wait()
+			time.Sleep(10 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			close(results)
+
+			for v := range results {
+				if v != "value" {
+					t.Errorf("unexpected value: %v", v)
+				}
+			}
+			if got := atomic.LoadInt32(&calls); got != 1 {
+				t.Errorf("loader called %d times, want 1", got)
+			}
+			if v, ok := c.Get("key"); !ok || v != "value" {
+				t.Errorf("expected loaded value to be cached, got %v, %v", v, ok)
+			}
+		})
+	}
+}
+
+func TestLoadingCacheSharesError(t *testing.T) {
+	c := NewLoadingCache(NewExpiring(), time.Hour)
+	errLoad := errors.New("backend down")
+
+	var calls int32
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errLoad
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetOrLoad(context.Background(), "key", loader); err != errLoad {
+			t.Errorf("unexpected error: got=%v, want=%v", err, errLoad)
+		}
+	}
+	// Without a negative ttl every miss calls the loader again.
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("loader called %d times, want 2", got)
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Errorf("failed load must not be cached")
+	}
+}
+
+func TestLoadingCacheNegativeTTL(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewLoadingCache(NewExpiringWithClock(fc), time.Hour, WithNegativeTTL(time.Second))
+	errLoad := errors.New("not found")
+
+	var calls int32
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return nil, errLoad
+		}
+		return "value", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetOrLoad(context.Background(), "key", loader); err != errLoad {
+			t.Errorf("unexpected error: got=%v, want=%v", err, errLoad)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("loader called %d times, want 1", got)
+	}
+
+	fc.Step(time.Second)
+	if v, err := c.GetOrLoad(context.Background(), "key", loader); err != nil || v != "value" {
+		t.Errorf("unexpected result after negative ttl: %v, %v", v, err)
+	}
+}
+
+func TestLoadingCacheWaiterContext(t *testing.T) {
+	c := NewLoadingCache(NewExpiring(), time.Hour)
+
+	release := make(chan struct{})
+	loading := make(chan struct{})
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		close(loading)
+		<-release
+		return "value", nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err := c.GetOrLoad(context.Background(), "key", loader); err != nil || v != "value" {
+			t.Errorf("unexpected result: %v, %v", v, err)
+		}
+	}()
+	<-loading
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetOrLoad(ctx, "key", loader); err != context.Canceled {
+		t.Errorf("unexpected error: got=%v, want=%v", err, context.Canceled)
+	}
+
+	close(release)
+	<-done
+}
+
+func TestLoadingCacheFirstCallerCanceled(t *testing.T) {
+	c := NewLoadingCache(NewExpiring(), time.Hour, WithNegativeTTL(time.Minute))
+
+	type ctxKey struct{}
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return ctx.Value(ctxKey{}), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "value"))
+	cancel()
+	if _, err := c.GetOrLoad(ctx, "key", loader); err != context.Canceled {
+		t.Errorf("unexpected error: got=%v, want=%v", err, context.Canceled)
+	}
+
+	// The load started by the canceled caller is shared and completes.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if v, err := c.GetOrLoad(context.Background(), "key", loader); err != nil || v != "value" {
+			t.Errorf("unexpected result: %v, %v", v, err)
+		}
+	}()
+	close(release)
+	<-done
+}
+
+func TestLoadingCacheContextErrorNotCached(t *testing.T) {
+	c := NewLoadingCache(NewExpiring(), time.Hour, WithNegativeTTL(time.Minute))
+
+	failing := func(ctx context.Context, key interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("query: %w", context.DeadlineExceeded)
+	}
+	if _, err := c.GetOrLoad(context.Background(), "key", failing); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	working := func(ctx context.Context, key interface{}) (interface{}, error) {
+		return "value", nil
+	}
+	if v, err := c.GetOrLoad(context.Background(), "key", working); err != nil || v != "value" {
+		t.Errorf("unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestLoadingCacheLoaderPanic(t *testing.T) {
+	c := NewLoadingCache(NewExpiring(), time.Hour, WithNegativeTTL(time.Minute))
+
+	panicking := func(ctx context.Context, key interface{}) (interface{}, error) {
+		panic("boom")
+	}
+	if _, err := c.GetOrLoad(context.Background(), "key", panicking); err == nil {
+		t.Errorf("expected an error from a panicking loader")
+	}
+
+	// The panic is not cached, the next miss loads again.
+	working := func(ctx context.Context, key interface{}) (interface{}, error) {
+		return "value", nil
+	}
+	if v, err := c.GetOrLoad(context.Background(), "key", working); err != nil || v != "value" {
+		t.Errorf("unexpected result: %v, %v", v, err)
+	}
+}
+
+func TestLoadingCacheRefreshAhead(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewLoadingCache(NewExpiringWithClock(fc), 10*time.Second, WithRefreshAfter(5*time.Second))
+
+	var version int32
+	refreshed := make(chan struct{}, 1)
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		v := atomic.AddInt32(&version, 1)
+		if v > 1 {
+			refreshed <- struct{}{}
+		}
+		return v, nil
+	}
+
+	if v, err := c.GetOrLoad(context.Background(), "key", loader); err != nil || v != int32(1) {
+		t.Fatalf("unexpected result: %v, %v", v, err)
+	}
+
+	// Still fresh, no refresh.
+	fc.Step(4 * time.Second)
+	if v, _ := c.GetOrLoad(context.Background(), "key", loader); v != int32(1) {
+		t.Fatalf("unexpected value: %v", v)
+	}
+
+	// Stale, the old value is served while it is refreshed.
+	fc.Step(2 * time.Second)
+	if v, _ := c.GetOrLoad(context.Background(), "key", loader); v != int32(1) {
+		t.Fatalf("expected stale value, got %v", v)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(wait.ForeverTestTimeout):
+		t.Fatalf("value was not refreshed")
+	}
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		v, _ := c.Get("key")
+		return v == int32(2), nil
+	})
+	if err != nil {
+		t.Fatalf("refreshed value was not stored")
+	}
+}
+
+func TestLoadingCacheRefreshBackoff(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewLoadingCache(NewExpiringWithClock(fc), 10*time.Second,
+		WithRefreshAfter(5*time.Second), WithRefreshBackoff(time.Second, 4*time.Second))
+
+	var calls int32
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			return "v1", nil
+		case 2:
+			return nil, errors.New("backend down")
+		}
+		return "v2", nil
+	}
+
+	if _, err := c.GetOrLoad(context.Background(), "key", loader); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fc.Step(6 * time.Second)
+	for i := 0; i < 3; i++ {
+		// Only a single refresh may run no matter how often the stale
+		// value is read.
+		if v, _ := c.GetOrLoad(context.Background(), "key", loader); v != "v1" {
+			t.Fatalf("expected stale value, got %v", v)
+		}
+	}
+
+	// The first refresh fails and backs off on the fake clock.
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return atomic.LoadInt32(&calls) == 2 && fc.HasWaiters(), nil
+	})
+	if err != nil {
+		t.Fatalf("refresh did not back off")
+	}
+	fc.Step(time.Second)
+	err = wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		v, _ := c.Get("key")
+		return v == "v2", nil
+	})
+	if err != nil {
+		t.Fatalf("refresh was not retried")
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("loader called %d times, want 3", got)
+	}
+}
+
+func TestLoadingCacheRefreshContextAndPanic(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewLoadingCache(NewExpiringWithClock(fc), 10*time.Second,
+		WithRefreshAfter(5*time.Second), WithRefreshBackoff(time.Second, 4*time.Second))
+
+	type ctxKey struct{}
+	var calls int32
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			return "v1", nil
+		case 2:
+			panic("boom")
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return ctx.Value(ctxKey{}), nil
+	}
+
+	if _, err := c.GetOrLoad(context.Background(), "key", loader); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fc.Step(6 * time.Second)
+
+	// The refresh keeps the values of the caller's context but outlives it.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v2"))
+	if v, _ := c.GetOrLoad(ctx, "key", loader); v != "v1" {
+		t.Fatalf("expected stale value, got %v", v)
+	}
+	cancel()
+
+	// The panicking refresh backs off like a failed one.
+	err := wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		return atomic.LoadInt32(&calls) == 2 && fc.HasWaiters(), nil
+	})
+	if err != nil {
+		t.Fatalf("refresh did not back off")
+	}
+	fc.Step(time.Second)
+	err = wait.PollImmediate(time.Millisecond, wait.ForeverTestTimeout, func() (bool, error) {
+		v, _ := c.Get("key")
+		return v == "v2", nil
+	})
+	if err != nil {
+		t.Fatalf("refresh was not retried")
+	}
+}
+
+func TestLoadingCacheHardTTL(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewLoadingCache(NewExpiringWithClock(fc), 10*time.Second, WithRefreshAfter(5*time.Second))
+
+	var calls int32
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	c.GetOrLoad(context.Background(), "key", loader)
+	fc.Step(11 * time.Second)
+	if _, ok := c.Get("key"); ok {
+		t.Fatalf("expected value to be gone after the hard ttl")
+	}
+	if v, _ := c.GetOrLoad(context.Background(), "key", loader); v != int32(2) {
+		t.Errorf("expected a synchronous load, got %v", v)
+	}
+}
@@ -1,10 +1,9 @@
 package cache
 
 import (
+	"errors"
 	"sync"
 	"time"
-
-	lru "github.com/hashicorp/golang-lru"
 )
 
 // Clock defines an interface for obtaining the current time
@@ -17,70 +16,260 @@ type realClock struct{}
 
 func (realClock) Now() time.Time { return time.Now() }
 
+// ErrEntryTooLarge is returned when an entry weighs more than the whole cache
+// may hold.
+var ErrEntryTooLarge = errors.New("cache: entry exceeds the maximum weight")
+
+// Weigher returns the weight of an entry, for example the approximate size of
+// the value in bytes. It must return the same weight for as long as the entry
+// is in the cache.
+type Weigher[K comparable, V any] func(key K, value V) int64
+
 // LRUExpireCache is a cache that ensures the mostly recently accessed keys are returned with
-// a ttl beyond which keys are forcibly expired.
-type LRUExpireCache struct {
+// a ttl beyond which keys are forcibly expired. It is the untyped form of LRUCache.
+type LRUExpireCache = LRUCache[interface{}, interface{}]
+
+// LRUCache is a typed cache that ensures the mostly recently accessed keys are returned with
+// a ttl beyond which keys are forcibly expired. When the cache is full, the entry to evict
+// is chosen by its Policy, which is LRU unless another one is passed with WithPolicy.
+type LRUCache[K comparable, V any] struct {
 	// clock is used to obtain the current time
 	clock Clock
 
-	cache *lru.Cache
-	lock  sync.Mutex
+	// lock protects the below fields
+	lock    sync.Mutex
+	entries map[K]*cacheEntry[V]
+	policy  Policy[K]
+	// maxSize is the maximum number of entries, 0 means no limit.
+	maxSize int
+
+	// onEvict is called for every entry which leaves the cache.
+	onEvict EvictFunc[K, V]
+	stats   *statsCounter
+	// evicted collects the entries removed while lock is held, they are
+	// reported to onEvict once lock is released.
+	evicted []evictedEntry[K, V]
+
+	// weigher is nil unless the cache is limited by weight.
+	weigher     Weigher[K, V]
+	maxWeight   int64
+	totalWeight int64
 }
 
 // NewLRUExpireCache creates an expiring cache with the given size
-func NewLRUExpireCache(maxSize int) *LRUExpireCache {
-	return NewLRUExpireCacheWithClock(maxSize, realClock{})
+func NewLRUExpireCache(maxSize int, opts ...LRUOption) *LRUExpireCache {
+	return NewLRUCache[interface{}, interface{}](maxSize, opts...)
 }
 
 // NewLRUExpireCacheWithClock creates an expiring cache with the given size, using the specified clock to obtain the current time.
-func NewLRUExpireCacheWithClock(maxSize int, clock Clock) *LRUExpireCache {
-	cache, err := lru.New(maxSize)
-	if err != nil {
+// If the cache is limited by weight, maxSize may be 0 to not limit the number of entries.
+func NewLRUExpireCacheWithClock(maxSize int, clock Clock, opts ...LRUOption) *LRUExpireCache {
+	return NewLRUCacheWithClock[interface{}, interface{}](maxSize, clock, opts...)
+}
+
+// NewLRUCache creates a typed expiring cache with the given size
+func NewLRUCache[K comparable, V any](maxSize int, opts ...LRUOption) *LRUCache[K, V] {
+	return NewLRUCacheWithClock[K, V](maxSize, realClock{}, opts...)
+}
+
+// NewLRUCacheWithClock creates a typed expiring cache with the given size, using the specified clock to obtain the current time.
+// If the cache is limited by weight, maxSize may be 0 to not limit the number of entries.
+func NewLRUCacheWithClock[K comparable, V any](maxSize int, clock Clock, opts ...LRUOption) *LRUCache[K, V] {
+	options := buildLRUOptions(opts)
+	weigher := weigherOf[K, V](options)
+	if maxSize < 0 || (maxSize == 0 && weigher == nil) {
 		// if called with an invalid size
-		panic(err)
+		panic("must provide a positive size")
+	}
+	return &LRUCache[K, V]{
+		clock:     clock,
+		entries:   make(map[K]*cacheEntry[V]),
+		policy:    policyOf[K](options)(maxSize),
+		maxSize:   maxSize,
+		onEvict:   evictFuncOf[K, V](options),
+		stats:     newStatsCounter(options.recorder),
+		weigher:   weigher,
+		maxWeight: options.maxWeight,
 	}
-	return &LRUExpireCache{clock: clock, cache: cache}
 }
 
-type cacheEntry struct {
-	value      interface{}
+type cacheEntry[V any] struct {
+	value      V
 	expireTime time.Time
+	weight     int64
 }
 
 // Add adds the value to the cache at key with the specified maximum duration.
-func (c *LRUExpireCache) Add(key interface{}, value interface{}, ttl time.Duration) {
+// If the cache is limited by weight and the entry alone is heavier than the
+// limit, the cache is left unchanged and ErrEntryTooLarge is returned.
+func (c *LRUCache[K, V]) Add(key K, value V, ttl time.Duration) error {
+	now := c.clock.Now()
+
+	weight, err := c.weigh(key, value)
+	if err != nil {
+		return err
+	}
+
 	c.lock.Lock()
-	defer c.lock.Unlock()
-	c.cache.Add(key, &cacheEntry{value, c.clock.Now().Add(ttl)})
+	c.addLocked(now, key, value, weight, ttl)
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return nil
+}
+
+// addLocked sets the entry of key and evicts entries until the cache fits its
+// limits again. The weight must have been checked against the limit by the
+// caller. It must be called with lock held.
+func (c *LRUCache[K, V]) addLocked(now time.Time, key K, value V, weight int64, ttl time.Duration) {
+	if old, ok := c.entries[key]; ok {
+		c.totalWeight -= old.weight
+		if c.onEvict != nil {
+			reason := Replaced
+			if now.After(old.expireTime) {
+				reason = Expired
+			}
+			c.evicted = append(c.evicted, evictedEntry[K, V]{key: key, value: old.value, reason: reason})
+		}
+		c.policy.Access(key)
+	} else {
+		c.policy.Add(key)
+	}
+	c.entries[key] = &cacheEntry[V]{value: value, expireTime: now.Add(ttl), weight: weight}
+	c.totalWeight += weight
+	for c.overflowLocked() {
+		victim, ok := c.policy.Evict()
+		if !ok {
+			break
+		}
+		c.removeLocked(victim, Evicted)
+	}
 }
 
 // Get returns the value at the specified key from the cache if it exists and is not
 // expired, or returns false.
-func (c *LRUExpireCache) Get(key interface{}) (interface{}, bool) {
+func (c *LRUCache[K, V]) Get(key K) (value V, ok bool) {
 	c.lock.Lock()
-	defer c.lock.Unlock()
-	e, ok := c.cache.Get(key)
+	value, ok = c.getLocked(c.clock.Now(), key)
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return value, ok
+}
+
+// getLocked looks up the entry of key at now and counts the lookup. An
+// expired entry is removed. It must be called with lock held.
+func (c *LRUCache[K, V]) getLocked(now time.Time, key K) (value V, ok bool) {
+	e, ok := c.entries[key]
 	if !ok {
-		return nil, false
+		c.stats.miss()
+		return value, false
 	}
-	if c.clock.Now().After(e.(*cacheEntry).expireTime) {
-		c.cache.Remove(key)
-		return nil, false
+	if now.After(e.expireTime) {
+		c.stats.expiredRead()
+		c.policy.Remove(key)
+		c.removeLocked(key, Expired)
+		return value, false
 	}
-	return e.(*cacheEntry).value, true
+	c.policy.Access(key)
+	c.stats.hit()
+	return e.value, true
 }
 
-// Remove removes the specified key from the cache if it exists
-func (c *LRUExpireCache) Remove(key interface{}) {
+// peek is like Get but neither updates the recency of key nor counts towards
+// the cache statistics.
+func (c *LRUCache[K, V]) peek(key K) (value V, ok bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.cache.Remove(key)
+	e, ok := c.entries[key]
+	if !ok || c.clock.Now().After(e.expireTime) {
+		return value, false
+	}
+	return e.value, true
+}
+
+// Remove removes the specified key from the cache if it exists
+func (c *LRUCache[K, V]) Remove(key K) {
+	c.lock.Lock()
+	if _, ok := c.entries[key]; ok {
+		c.policy.Remove(key)
+		c.removeLocked(key, Deleted)
+	}
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *LRUCache[K, V]) Stats() Stats {
+	s := c.stats.snapshot()
+	c.lock.Lock()
+	s.Size = len(c.entries)
+	s.Weight = c.totalWeight
+	c.lock.Unlock()
+	return s
 }
 
 // Keys returns all the keys in the cache, even if they are expired. Subsequent calls to
-// get may return not found. It returns all keys from oldest to newest.
-func (c *LRUExpireCache) Keys() []interface{} {
+// get may return not found. It returns all keys from oldest to newest, as ordered by the
+// policy of the cache.
+func (c *LRUCache[K, V]) Keys() []K {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.policy.Keys()
+}
+
+// Len returns the number of entries in the cache, even if they are expired.
+func (c *LRUCache[K, V]) Len() int {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	return c.cache.Keys()
+	return len(c.entries)
+}
+
+// weigh returns the weight of an entry, or ErrEntryTooLarge if the entry alone
+// is heavier than the limit of the cache.
+func (c *LRUCache[K, V]) weigh(key K, value V) (int64, error) {
+	if c.weigher == nil {
+		return 0, nil
+	}
+	weight := c.weigher(key, value)
+	if weight > c.maxWeight {
+		return 0, ErrEntryTooLarge
+	}
+	return weight, nil
+}
+
+// overflowLocked returns true if the cache holds more entries or more weight
+// than it may. It must be called with lock held.
+func (c *LRUCache[K, V]) overflowLocked() bool {
+	if c.maxSize > 0 && len(c.entries) > c.maxSize {
+		return true
+	}
+	return c.weigher != nil && c.totalWeight > c.maxWeight
+}
+
+// removeLocked removes the entry of key, reporting it with the given reason.
+// The caller is responsible for removing key from the policy. It must be
+// called with lock held.
+func (c *LRUCache[K, V]) removeLocked(key K, reason EvictReason) {
+	e := c.entries[key]
+	delete(c.entries, key)
+	c.totalWeight -= e.weight
+	if reason == Evicted {
+		c.stats.evict(1)
+	}
+	if c.onEvict != nil {
+		c.evicted = append(c.evicted, evictedEntry[K, V]{key: key, value: e.value, reason: reason})
+	}
+}
+
+// takeEvicted returns the entries collected while lock was held and resets
+// the list. It must be called with lock held.
+func (c *LRUCache[K, V]) takeEvicted() []evictedEntry[K, V] {
+	evicted := c.evicted
+	c.evicted = nil
+	return evicted
 }
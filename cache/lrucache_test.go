@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -48,3 +49,112 @@ func TestLRUOverflow(t *testing.T) {
 	expectEntry(t, c, "elem4", "4")
 	expectEntry(t, c, "elem5", "5")
 }
+
+func TestLRUEvictFunc(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	r := &evictRecorder{}
+	c := NewLRUExpireCacheWithClock(2, fakeClock, WithEvictFunc(r.onEvict))
+
+	c.Add("elem1", "1", 10*time.Hour)
+	c.Add("elem2", "2", 10*time.Hour)
+	expectEvicted(t, r)
+
+	c.Add("elem1", "1b", 10*time.Hour)
+	expectEvicted(t, r, evictRecord{"elem1", "1", Replaced})
+
+	c.Add("elem3", "3", 10*time.Hour)
+	expectEvicted(t, r, evictRecord{"elem2", "2", Evicted})
+
+	c.Remove("elem3")
+	expectEvicted(t, r, evictRecord{"elem3", "3", Deleted})
+
+	c.Add("short-lived", "4", time.Millisecond)
+	fakeClock.Step(2 * time.Millisecond)
+	expectNotEntry(t, c, "short-lived")
+	expectEvicted(t, r, evictRecord{"short-lived", "4", Expired})
+}
+
+func TestLRUWeigher(t *testing.T) {
+	weigher := func(key interface{}, value interface{}) int64 {
+		return int64(len(value.(string)))
+	}
+	r := &evictRecorder{}
+	c := NewLRUExpireCache(0, WithWeigher(10, weigher), WithEvictFunc(r.onEvict))
+
+	for _, kv := range [][2]string{{"a", "aaaa"}, {"b", "bbb"}, {"c", "ccc"}} {
+		if err := c.Add(kv[0], kv[1], time.Hour); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := c.Stats().Weight; got != 10 {
+		t.Errorf("unexpected weight: got=%d, want=10", got)
+	}
+
+	// Touch a so that b is the least recently used entry.
+	expectEntry(t, c, "a", "aaaa")
+	if err := c.Add("d", "dddd", time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectNotEntry(t, c, "b")
+	expectNotEntry(t, c, "c")
+	expectEntry(t, c, "a", "aaaa")
+	expectEntry(t, c, "d", "dddd")
+	expectEvicted(t, r, evictRecord{"b", "bbb", Evicted}, evictRecord{"c", "ccc", Evicted})
+
+	// Replacing an entry swaps its weight.
+	if err := c.Add("a", "a", time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := c.Stats().Weight; got != 5 {
+		t.Errorf("unexpected weight: got=%d, want=5", got)
+	}
+
+	if err := c.Add("huge", "0123456789a", time.Hour); err != ErrEntryTooLarge {
+		t.Errorf("unexpected error: got=%v, want=%v", err, ErrEntryTooLarge)
+	}
+	expectNotEntry(t, c, "huge")
+	expectEntry(t, c, "d", "dddd")
+
+	c.Remove("d")
+	if got := c.Stats().Weight; got != 1 {
+		t.Errorf("unexpected weight: got=%d, want=1", got)
+	}
+}
+
+func TestLRUWeigherAndSize(t *testing.T) {
+	weigher := func(key interface{}, value interface{}) int64 { return 1 }
+	c := NewLRUExpireCache(2, WithWeigher(100, weigher))
+	c.Add("a", "a", time.Hour)
+	c.Add("b", "b", time.Hour)
+	c.Add("c", "c", time.Hour)
+	expectNotEntry(t, c, "a")
+	if got := c.Stats().Weight; got != 2 {
+		t.Errorf("unexpected weight: got=%d, want=2", got)
+	}
+}
+
+func TestTypedLRUCache(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	weigher := func(key string, value []byte) int64 { return int64(len(value)) }
+	c := NewLRUCacheWithClock[string, []byte](0, fakeClock, WithWeigher(8, weigher))
+
+	c.Add("a", []byte("aaaa"), time.Hour)
+	c.Add("b", []byte("bbbb"), time.Minute)
+	if v, ok := c.Get("a"); !ok || string(v) != "aaaa" {
+		t.Errorf("Expected aaaa, true, got %q, %v", v, ok)
+	}
+	c.Add("c", []byte("cc"), time.Hour)
+
+	var keys []string = c.Keys()
+	if want := []string{"a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", keys, want)
+	}
+	if got := c.Len(); got != 2 {
+		t.Errorf("unexpected length: got=%d, want=2", got)
+	}
+
+	fakeClock.Step(2 * time.Hour)
+	if v, ok := c.Get("c"); ok || v != nil {
+		t.Errorf("Expected nil, false, got %q, %v", v, ok)
+	}
+}
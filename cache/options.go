@@ -0,0 +1,337 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// EvictReason describes why an entry left a cache.
+type EvictReason int
+
+const (
+	// Expired means the entry was removed because its ttl elapsed.
+	Expired EvictReason = iota + 1
+	// Evicted means the entry was removed to make room for other entries.
+	Evicted
+	// Deleted means the entry was removed explicitly by the caller.
+	Deleted
+	// Replaced means the entry was overwritten by a newer value for the same key.
+	Replaced
+)
+
+// String returns the name of the reason.
+func (r EvictReason) String() string {
+	switch r {
+	case Expired:
+		return "Expired"
+	case Evicted:
+		return "Evicted"
+	case Deleted:
+		return "Deleted"
+	case Replaced:
+		return "Replaced"
+	}
+	return fmt.Sprintf("EvictReason(%d)", int(r))
+}
+
+// EvictFunc is called with the key, the value and the reason whenever an
+// entry leaves a cache. It is called after the cache has released its lock,
+// so it may safely call back into the cache.
+type EvictFunc[K comparable, V any] func(key K, value V, reason EvictReason)
+
+// ExpiringOption customizes an ExpiringCache, an Expiring or a
+// ShardedExpiring.
+type ExpiringOption interface {
+	applyToExpiring(opts *options)
+}
+
+// LRUOption customizes an LRUCache or an LRUExpireCache.
+type LRUOption interface {
+	applyToLRU(opts *options)
+}
+
+// LoadingOption customizes a LoadingCache.
+type LoadingOption interface {
+	applyToLoading(opts *options)
+}
+
+// TieredOption customizes a TieredCache.
+type TieredOption interface {
+	applyToTiered(opts *options)
+}
+
+// StoreOption customizes the caches which hold their entries themselves, an
+// ExpiringCache or an LRUCache.
+type StoreOption interface {
+	ExpiringOption
+	LRUOption
+}
+
+// StatsOption customizes the caches which keep statistics, an
+// ExpiringCache, an LRUCache or a LoadingCache.
+type StatsOption interface {
+	ExpiringOption
+	LRUOption
+	LoadingOption
+}
+
+type expiringOption func(opts *options)
+
+func (f expiringOption) applyToExpiring(opts *options) { f(opts) }
+
+type lruOption func(opts *options)
+
+func (f lruOption) applyToLRU(opts *options) { f(opts) }
+
+type loadingOption func(opts *options)
+
+func (f loadingOption) applyToLoading(opts *options) { f(opts) }
+
+type tieredOption func(opts *options)
+
+func (f tieredOption) applyToTiered(opts *options) { f(opts) }
+
+type storeOption func(opts *options)
+
+func (f storeOption) applyToExpiring(opts *options) { f(opts) }
+func (f storeOption) applyToLRU(opts *options)      { f(opts) }
+
+type statsOption func(opts *options)
+
+func (f statsOption) applyToExpiring(opts *options) { f(opts) }
+func (f statsOption) applyToLRU(opts *options)      { f(opts) }
+func (f statsOption) applyToLoading(opts *options)  { f(opts) }
+
+type options struct {
+	// onEvict, weigher and policy hold an EvictFunc[K, V], a Weigher[K, V]
+	// and a PolicyFunc[K], the cache checks that they match its types when
+	// it is created.
+	onEvict   interface{}
+	recorder  StatsRecorder
+	weigher   interface{}
+	maxWeight int64
+	// estimate is true if entries without a weigher are weighed with
+	// EstimateSize.
+	estimate    bool
+	maxEntries  int
+	policy      interface{}
+	sliding     bool
+	negativeTTL time.Duration
+
+	refreshAfter      time.Duration
+	refreshBackoff    time.Duration
+	refreshMaxBackoff time.Duration
+
+	writeMode WriteMode
+	l1TTL     time.Duration
+}
+
+// WithEvictFunc sets the function which is called whenever an entry leaves
+// the cache. The key and value types of f must match the ones of the cache,
+// creating a cache with a mismatched f panics.
+func WithEvictFunc[K comparable, V any](f EvictFunc[K, V]) StoreOption {
+	return storeOption(func(opts *options) {
+		opts.onEvict = f
+	})
+}
+
+// WithStatsRecorder sets a StatsRecorder which is told about every change
+// to the statistics of the cache.
+func WithStatsRecorder(r StatsRecorder) StatsOption {
+	return statsOption(func(opts *options) {
+		opts.recorder = r
+	})
+}
+
+// WithWeigher limits an LRUCache or an ExpiringCache by the total weight of
+// their entries. An LRUCache evicts the entries chosen by its policy and an
+// ExpiringCache the entries which expire soonest, until the total weight is at
+// most maxWeight. The key and value types of w must match the ones of the
+// cache, creating a cache with a mismatched w panics.
+func WithWeigher[K comparable, V any](maxWeight int64, w Weigher[K, V]) StoreOption {
+	return storeOption(func(opts *options) {
+		opts.weigher = w
+		opts.maxWeight = maxWeight
+	})
+}
+
+// WithMaxBytes is like WithWeigher with a weigher which estimates the memory
+// used by an entry with EstimateSize, limiting the cache to about budget
+// bytes.
+func WithMaxBytes(budget int64) StoreOption {
+	return storeOption(func(opts *options) {
+		opts.estimate = true
+		opts.maxWeight = budget
+	})
+}
+
+// WithMaxEntries limits an ExpiringCache to n entries. Once the limit is
+// reached, every Set evicts the entries which expire soonest.
+func WithMaxEntries(n int) ExpiringOption {
+	return expiringOption(func(opts *options) {
+		opts.maxEntries = n
+	})
+}
+
+// WithSlidingExpiration makes an ExpiringCache restart the ttl of an entry
+// every time the entry is read with Get.
+func WithSlidingExpiration() ExpiringOption {
+	return expiringOption(func(opts *options) {
+		opts.sliding = true
+	})
+}
+
+// WithPolicy sets the eviction policy of an LRUCache. newPolicy is called
+// once with the maximum size of the cache. The key type of newPolicy must
+// match the one of the cache, creating a cache with a mismatched newPolicy
+// panics.
+func WithPolicy[K comparable](newPolicy PolicyFunc[K]) LRUOption {
+	return lruOption(func(opts *options) {
+		opts.policy = newPolicy
+	})
+}
+
+// WithWriteMode sets how a TieredCache handles writes.
+func WithWriteMode(mode WriteMode) TieredOption {
+	return tieredOption(func(opts *options) {
+		opts.writeMode = mode
+	})
+}
+
+// WithL1TTL caps the time a TieredCache keeps an entry in its in-memory cache,
+// so that changes made to the backend by other processes are seen at the
+// latest after ttl.
+func WithL1TTL(ttl time.Duration) TieredOption {
+	return tieredOption(func(opts *options) {
+		opts.l1TTL = ttl
+	})
+}
+
+// WithNegativeTTL makes a LoadingCache remember failed loads for ttl, during
+// which GetOrLoad returns the cached error instead of calling the loader
+// again.
+func WithNegativeTTL(ttl time.Duration) LoadingOption {
+	return loadingOption(func(opts *options) {
+		opts.negativeTTL = ttl
+	})
+}
+
+// WithRefreshAfter turns on stale-while-revalidate for a LoadingCache. A
+// loaded value is fresh for ttl and stale afterwards until the hard ttl of
+// the cache runs out. GetOrLoad keeps returning a stale value, and starts a
+// single background refresh for it.
+func WithRefreshAfter(ttl time.Duration) LoadingOption {
+	return loadingOption(func(opts *options) {
+		opts.refreshAfter = ttl
+	})
+}
+
+// WithRefreshBackoff sets the exponential backoff between failed background
+// refreshes of a LoadingCache. It starts at initial and doubles up to max.
+func WithRefreshBackoff(initial, max time.Duration) LoadingOption {
+	return loadingOption(func(opts *options) {
+		opts.refreshBackoff = initial
+		opts.refreshMaxBackoff = max
+	})
+}
+
+func newOptions() *options {
+	return &options{
+		refreshBackoff:    time.Second,
+		refreshMaxBackoff: time.Minute,
+	}
+}
+
+func buildExpiringOptions(opts []ExpiringOption) *options {
+	options := newOptions()
+	for _, opt := range opts {
+		opt.applyToExpiring(options)
+	}
+	return options
+}
+
+func buildLRUOptions(opts []LRUOption) *options {
+	options := newOptions()
+	for _, opt := range opts {
+		opt.applyToLRU(options)
+	}
+	return options
+}
+
+func buildLoadingOptions(opts []LoadingOption) *options {
+	options := newOptions()
+	for _, opt := range opts {
+		opt.applyToLoading(options)
+	}
+	return options
+}
+
+func buildTieredOptions(opts []TieredOption) *options {
+	options := newOptions()
+	for _, opt := range opts {
+		opt.applyToTiered(options)
+	}
+	return options
+}
+
+// evictFuncOf returns the evict func of options for a cache of K and V.
+func evictFuncOf[K comparable, V any](options *options) EvictFunc[K, V] {
+	if options.onEvict == nil {
+		return nil
+	}
+	f, ok := options.onEvict.(EvictFunc[K, V])
+	if !ok {
+		panic(fmt.Sprintf("cache: evict func %T does not match cache of %T", options.onEvict, EvictFunc[K, V](nil)))
+	}
+	return f
+}
+
+// weigherOf returns the weigher of options for a cache of K and V, nil if the
+// cache is not limited by weight.
+func weigherOf[K comparable, V any](options *options) Weigher[K, V] {
+	if options.weigher == nil {
+		if options.estimate {
+			return estimateWeight[K, V]
+		}
+		return nil
+	}
+	w, ok := options.weigher.(Weigher[K, V])
+	if !ok {
+		panic(fmt.Sprintf("cache: weigher %T does not match cache of %T", options.weigher, Weigher[K, V](nil)))
+	}
+	return w
+}
+
+// policyOf returns the policy func of options for a cache of K, NewLRUPolicy
+// if none was set.
+func policyOf[K comparable](options *options) PolicyFunc[K] {
+	if options.policy == nil {
+		return NewLRUPolicy[K]
+	}
+	f, ok := options.policy.(PolicyFunc[K])
+	if !ok {
+		panic(fmt.Sprintf("cache: policy %T does not match cache of %T", options.policy, PolicyFunc[K](nil)))
+	}
+	return f
+}
+
+func estimateWeight[K comparable, V any](key K, value V) int64 {
+	return EstimateSize(key) + EstimateSize(value)
+}
+
+// evictedEntry is an entry which left a cache while its lock was held. The
+// cache collects these and reports them once the lock has been released.
+type evictedEntry[K comparable, V any] struct {
+	key    K
+	value  V
+	reason EvictReason
+}
+
+func notifyEvicted[K comparable, V any](f EvictFunc[K, V], evicted []evictedEntry[K, V]) {
+	if f == nil {
+		return
+	}
+	for _, e := range evicted {
+		f(e.key, e.value, e.reason)
+	}
+}
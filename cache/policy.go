@@ -0,0 +1,520 @@
+package cache
+
+// Policy decides which entry a bounded cache evicts when it is full. A policy
+// only tracks keys, the cache keeps the values. Policies are not safe for
+// concurrent use, the cache serializes all calls under its own lock.
+type Policy[K comparable] interface {
+	// Add starts tracking key, which was just inserted into the cache.
+	Add(key K)
+	// Access records a hit on, or an update of, a tracked key.
+	Access(key K)
+	// Remove stops tracking key, which left the cache for a reason other
+	// than eviction.
+	Remove(key K)
+	// Evict chooses a tracked key to evict, stops tracking it and returns
+	// it. It never chooses the key passed to the latest Add while other keys
+	// are tracked, so that a new entry is not evicted to make room for
+	// itself.
+	Evict() (K, bool)
+	// Keys returns the tracked keys, roughly in the order in which they
+	// would be evicted.
+	Keys() []K
+	// Len returns the number of tracked keys.
+	Len() int
+}
+
+// PolicyFunc returns a new Policy for a cache which holds at most size
+// entries. size is 0 for a cache limited only by weight, policies which keep
+// history then bound it by the number of tracked keys instead.
+type PolicyFunc[K comparable] func(size int) Policy[K]
+
+var (
+	_ PolicyFunc[string] = NewLRUPolicy[string]
+	_ PolicyFunc[string] = NewLFUPolicy[string]
+	_ PolicyFunc[string] = NewTwoQueuePolicy[string]
+	_ PolicyFunc[string] = NewARCPolicy[string]
+)
+
+// newestKey remembers the key passed to the latest Add of a policy.
+type newestKey[K comparable] struct {
+	key K
+	set bool
+}
+
+// is returns true if key is the remembered key.
+func (n newestKey[K]) is(key K) bool {
+	return n.set && n.key == key
+}
+
+// keyElem is an element of a keyList.
+type keyElem[K comparable] struct {
+	key        K
+	prev, next *keyElem[K]
+}
+
+// keyList is a list of keys with O(1) lookup of the element holding a key.
+// The front of the list is the most recent end.
+type keyList[K comparable] struct {
+	// root links the front and the back of the circular list, root.next
+	// is the front and root.prev the back.
+	root  keyElem[K]
+	items map[K]*keyElem[K]
+}
+
+func newKeyList[K comparable]() *keyList[K] {
+	l := &keyList[K]{items: make(map[K]*keyElem[K])}
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	return l
+}
+
+func (l *keyList[K]) contains(key K) bool {
+	_, ok := l.items[key]
+	return ok
+}
+
+func (l *keyList[K]) pushFront(key K) {
+	e := &keyElem[K]{key: key}
+	l.link(e)
+	l.items[key] = e
+}
+
+func (l *keyList[K]) moveToFront(key K) {
+	e := l.items[key]
+	l.unlink(e)
+	l.link(e)
+}
+
+func (l *keyList[K]) remove(key K) bool {
+	e, ok := l.items[key]
+	if !ok {
+		return false
+	}
+	l.unlink(e)
+	delete(l.items, key)
+	return true
+}
+
+// link inserts e at the front of the list.
+func (l *keyList[K]) link(e *keyElem[K]) {
+	e.prev = &l.root
+	e.next = l.root.next
+	e.prev.next = e
+	e.next.prev = e
+}
+
+func (l *keyList[K]) unlink(e *keyElem[K]) {
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev, e.next = nil, nil
+}
+
+// oldest returns the least recent key other than skip, if there is one.
+func (l *keyList[K]) oldest(skip newestKey[K]) (key K, ok bool) {
+	for e := l.root.prev; e != &l.root; e = e.prev {
+		if !skip.is(e.key) {
+			return e.key, true
+		}
+	}
+	return key, false
+}
+
+func (l *keyList[K]) removeOldest() {
+	if e := l.root.prev; e != &l.root {
+		l.remove(e.key)
+	}
+}
+
+// keys appends the keys from the oldest to the newest to keys.
+func (l *keyList[K]) keys(keys []K) []K {
+	for e := l.root.prev; e != &l.root; e = e.prev {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+func (l *keyList[K]) len() int {
+	return len(l.items)
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy[K comparable] struct {
+	keys *keyList[K]
+}
+
+// NewLRUPolicy returns a policy which evicts the least recently used key.
+func NewLRUPolicy[K comparable](size int) Policy[K] {
+	return &lruPolicy[K]{keys: newKeyList[K]()}
+}
+
+func (p *lruPolicy[K]) Add(key K)    { p.keys.pushFront(key) }
+func (p *lruPolicy[K]) Access(key K) { p.keys.moveToFront(key) }
+func (p *lruPolicy[K]) Remove(key K) { p.keys.remove(key) }
+func (p *lruPolicy[K]) Keys() []K    { return p.keys.keys(nil) }
+func (p *lruPolicy[K]) Len() int     { return p.keys.len() }
+
+func (p *lruPolicy[K]) Evict() (K, bool) {
+	key, ok := p.keys.oldest(newestKey[K]{})
+	if ok {
+		p.keys.remove(key)
+	}
+	return key, ok
+}
+
+// lfuPolicy evicts the least frequently used key. Keys with the same
+// frequency are evicted in the order they reached it.
+type lfuPolicy[K comparable] struct {
+	// root links the buckets, one per frequency in use, ordered by
+	// ascending frequency from root.next.
+	root  lfuBucket[K]
+	items map[K]*lfuBucket[K]
+	// newest is the key passed to the latest Add.
+	newest newestKey[K]
+}
+
+// lfuBucket holds the keys used freq times, the oldest being the first to
+// have reached freq.
+type lfuBucket[K comparable] struct {
+	freq       int
+	keys       *keyList[K]
+	prev, next *lfuBucket[K]
+}
+
+// NewLFUPolicy returns a policy which evicts the least frequently used key.
+func NewLFUPolicy[K comparable](size int) Policy[K] {
+	p := &lfuPolicy[K]{items: make(map[K]*lfuBucket[K])}
+	p.root.next = &p.root
+	p.root.prev = &p.root
+	return p
+}
+
+func (p *lfuPolicy[K]) Add(key K) {
+	b := p.bucketAfter(&p.root, 1)
+	b.keys.pushFront(key)
+	p.items[key] = b
+	p.newest = newestKey[K]{key: key, set: true}
+}
+
+func (p *lfuPolicy[K]) Access(key K) {
+	cur, ok := p.items[key]
+	if !ok {
+		return
+	}
+	next := p.bucketAfter(cur, cur.freq+1)
+	next.keys.pushFront(key)
+	p.items[key] = next
+	p.unlink(cur, key)
+}
+
+func (p *lfuPolicy[K]) Remove(key K) {
+	b, ok := p.items[key]
+	if !ok {
+		return
+	}
+	p.unlink(b, key)
+	delete(p.items, key)
+	if p.newest.is(key) {
+		p.newest = newestKey[K]{}
+	}
+}
+
+func (p *lfuPolicy[K]) Evict() (K, bool) {
+	for b := p.root.next; b != &p.root; b = b.next {
+		if key, ok := b.keys.oldest(p.newest); ok {
+			p.Remove(key)
+			return key, true
+		}
+	}
+	if p.newest.set {
+		key := p.newest.key
+		p.Remove(key)
+		return key, true
+	}
+	var zero K
+	return zero, false
+}
+
+func (p *lfuPolicy[K]) Keys() []K {
+	keys := make([]K, 0, len(p.items))
+	for b := p.root.next; b != &p.root; b = b.next {
+		keys = b.keys.keys(keys)
+	}
+	return keys
+}
+
+func (p *lfuPolicy[K]) Len() int {
+	return len(p.items)
+}
+
+// bucketAfter returns the bucket of freq, which follows prev, creating it if
+// needed.
+func (p *lfuPolicy[K]) bucketAfter(prev *lfuBucket[K], freq int) *lfuBucket[K] {
+	if next := prev.next; next != &p.root && next.freq == freq {
+		return next
+	}
+	b := &lfuBucket[K]{freq: freq, keys: newKeyList[K](), prev: prev, next: prev.next}
+	b.prev.next = b
+	b.next.prev = b
+	return b
+}
+
+// unlink removes key from the bucket b and drops b once it is empty.
+func (p *lfuPolicy[K]) unlink(b *lfuBucket[K], key K) {
+	b.keys.remove(key)
+	if b.keys.len() == 0 {
+		b.prev.next = b.next
+		b.next.prev = b.prev
+	}
+}
+
+const (
+	// twoQueueRecentRatio is the share of the cache for keys seen once.
+	twoQueueRecentRatio = 0.25
+	// twoQueueGhostRatio is the number of evicted recent keys remembered,
+	// relative to the size of the cache.
+	twoQueueGhostRatio = 0.5
+)
+
+// twoQueuePolicy implements the 2Q algorithm. Keys seen once live in a
+// small recent queue, so a scan over many keys only churns that queue and
+// leaves the frequently used keys alone.
+type twoQueuePolicy[K comparable] struct {
+	size int
+
+	recent   *keyList[K]
+	frequent *keyList[K]
+	// ghost remembers keys recently evicted from recent. A key which is
+	// added again while in ghost goes straight to frequent.
+	ghost *keyList[K]
+
+	newest newestKey[K]
+}
+
+// NewTwoQueuePolicy returns a policy implementing the 2Q algorithm, which
+// resists being flushed by scans.
+func NewTwoQueuePolicy[K comparable](size int) Policy[K] {
+	return &twoQueuePolicy[K]{
+		size:     size,
+		recent:   newKeyList[K](),
+		frequent: newKeyList[K](),
+		ghost:    newKeyList[K](),
+	}
+}
+
+// capacity returns the size of the cache, or the number of tracked keys if
+// the cache is not limited by number of entries.
+func (p *twoQueuePolicy[K]) capacity() int {
+	if p.size > 0 {
+		return p.size
+	}
+	return p.Len()
+}
+
+func (p *twoQueuePolicy[K]) Add(key K) {
+	if p.ghost.remove(key) {
+		p.frequent.pushFront(key)
+	} else {
+		p.recent.pushFront(key)
+	}
+	p.newest = newestKey[K]{key: key, set: true}
+}
+
+func (p *twoQueuePolicy[K]) Access(key K) {
+	if p.recent.remove(key) {
+		p.frequent.pushFront(key)
+		return
+	}
+	if p.frequent.contains(key) {
+		p.frequent.moveToFront(key)
+	}
+}
+
+func (p *twoQueuePolicy[K]) Remove(key K) {
+	if !p.recent.remove(key) {
+		p.frequent.remove(key)
+	}
+	if p.newest.is(key) {
+		p.newest = newestKey[K]{}
+	}
+}
+
+func (p *twoQueuePolicy[K]) Evict() (K, bool) {
+	capacity := p.capacity()
+	recentSize := int(float64(capacity) * twoQueueRecentRatio)
+	if p.recent.len() > 0 && (p.recent.len() > recentSize || p.frequent.len() == 0) {
+		if key, ok := p.recent.oldest(p.newest); ok {
+			p.recent.remove(key)
+			p.ghost.pushFront(key)
+			for p.ghost.len() > int(float64(capacity)*twoQueueGhostRatio) {
+				p.ghost.removeOldest()
+			}
+			return key, true
+		}
+	}
+	if key, ok := p.frequent.oldest(p.newest); ok {
+		p.frequent.remove(key)
+		return key, true
+	}
+	if key, ok := p.recent.oldest(newestKey[K]{}); ok {
+		p.recent.remove(key)
+		return key, true
+	}
+	var zero K
+	return zero, false
+}
+
+func (p *twoQueuePolicy[K]) Keys() []K {
+	keys := make([]K, 0, p.Len())
+	return p.frequent.keys(p.recent.keys(keys))
+}
+
+func (p *twoQueuePolicy[K]) Len() int {
+	return p.recent.len() + p.frequent.len()
+}
+
+// arcPolicy implements the Adaptive Replacement Cache algorithm. It balances
+// between recency and frequency by adapting the share of the cache given to
+// keys seen once, based on hits on recently evicted keys.
+type arcPolicy[K comparable] struct {
+	// size is the size of the cache, 0 if it is not limited by number of
+	// entries.
+	size int
+	// p is the target number of keys in t1.
+	p int
+
+	// t1 holds keys seen once, t2 keys seen at least twice.
+	t1 *keyList[K]
+	t2 *keyList[K]
+	// b1 and b2 remember the keys recently evicted from t1 and t2.
+	b1 *keyList[K]
+	b2 *keyList[K]
+
+	newest newestKey[K]
+	// newestFromB2 is true if the latest Add was a hit in b2.
+	newestFromB2 bool
+}
+
+// NewARCPolicy returns a policy implementing the Adaptive Replacement Cache
+// algorithm.
+func NewARCPolicy[K comparable](size int) Policy[K] {
+	return &arcPolicy[K]{
+		size: size,
+		t1:   newKeyList[K](),
+		t2:   newKeyList[K](),
+		b1:   newKeyList[K](),
+		b2:   newKeyList[K](),
+	}
+}
+
+func (p *arcPolicy[K]) Add(key K) {
+	p.newest = newestKey[K]{key: key, set: true}
+	p.newestFromB2 = false
+
+	switch {
+	case p.b1.contains(key):
+		// A recently evicted key seen once is back, give more room to t1.
+		p.p = minInt(p.p+maxInt(1, p.b2.len()/p.b1.len()), p.capacity())
+		p.b1.remove(key)
+		p.t2.pushFront(key)
+	case p.b2.contains(key):
+		// A recently evicted frequent key is back, give more room to t2.
+		p.p = maxInt(p.p-maxInt(1, p.b1.len()/p.b2.len()), 0)
+		p.b2.remove(key)
+		p.t2.pushFront(key)
+		p.newestFromB2 = true
+	default:
+		p.t1.pushFront(key)
+	}
+}
+
+func (p *arcPolicy[K]) Access(key K) {
+	if p.t1.remove(key) {
+		p.t2.pushFront(key)
+		return
+	}
+	if p.t2.contains(key) {
+		p.t2.moveToFront(key)
+	}
+}
+
+func (p *arcPolicy[K]) Remove(key K) {
+	if !p.t1.remove(key) {
+		p.t2.remove(key)
+	}
+	if p.newest.is(key) {
+		p.newest = newestKey[K]{}
+	}
+}
+
+func (p *arcPolicy[K]) Evict() (K, bool) {
+	t1Len := p.t1.len()
+	fromT1 := t1Len > 0 && (t1Len > p.p || (p.newestFromB2 && t1Len == p.p))
+
+	first, second := p.t2, p.t1
+	if fromT1 {
+		first, second = p.t1, p.t2
+	}
+	for _, l := range []*keyList[K]{first, second} {
+		if key, ok := l.oldest(p.newest); ok {
+			p.evictFrom(l, key)
+			return key, true
+		}
+	}
+	for _, l := range []*keyList[K]{first, second} {
+		if key, ok := l.oldest(newestKey[K]{}); ok {
+			p.evictFrom(l, key)
+			return key, true
+		}
+	}
+	var zero K
+	return zero, false
+}
+
+// evictFrom moves key from the live list l to the matching ghost list.
+func (p *arcPolicy[K]) evictFrom(l *keyList[K], key K) {
+	l.remove(key)
+	ghost := p.b1
+	if l == p.t2 {
+		ghost = p.b2
+	}
+	ghost.pushFront(key)
+	capacity := p.capacity()
+	for ghost.len() > capacity {
+		ghost.removeOldest()
+	}
+	if p.newest.is(key) {
+		p.newest = newestKey[K]{}
+	}
+}
+
+// capacity returns the size of the cache, or the number of tracked keys if
+// the cache is not limited by number of entries.
+func (p *arcPolicy[K]) capacity() int {
+	if p.size > 0 {
+		return p.size
+	}
+	return maxInt(p.Len(), 1)
+}
+
+func (p *arcPolicy[K]) Keys() []K {
+	keys := make([]K, 0, p.Len())
+	return p.t2.keys(p.t1.keys(keys))
+}
+
+func (p *arcPolicy[K]) Len() int {
+	return p.t1.len() + p.t2.len()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,214 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func evictAll(p Policy[string]) []string {
+	var keys []string
+	for {
+		key, ok := p.Evict()
+		if !ok {
+			return keys
+		}
+		keys = append(keys, key)
+	}
+}
+
+func TestLRUPolicy(t *testing.T) {
+	p := NewLRUPolicy[string](3)
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("a")
+
+	if got, want := p.Keys(), []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", got, want)
+	}
+	p.Remove("c")
+	if got, want := evictAll(p), []string{"b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected eviction order: got=%v, want=%v", got, want)
+	}
+}
+
+func TestLFUPolicy(t *testing.T) {
+	p := NewLFUPolicy[string](3)
+	p.Add("a")
+	p.Add("b")
+	p.Add("c")
+	p.Access("a")
+	p.Access("a")
+	p.Access("c")
+
+	if got, want := p.Keys(), []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", got, want)
+	}
+	if key, _ := p.Evict(); key != "b" {
+		t.Errorf("expected b to be evicted, got %v", key)
+	}
+
+	// The newest key has the lowest frequency but must not be evicted to
+	// make room for itself.
+	p.Add("d")
+	if key, _ := p.Evict(); key != "c" {
+		t.Errorf("expected c to be evicted, got %v", key)
+	}
+	if got, want := evictAll(p), []string{"a", "d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected eviction order: got=%v, want=%v", got, want)
+	}
+	if p.Len() != 0 {
+		t.Errorf("unexpected length: %d", p.Len())
+	}
+}
+
+func TestTwoQueuePolicy(t *testing.T) {
+	p := NewTwoQueuePolicy[string](4)
+	p.Add("a")
+	p.Add("b")
+	p.Access("a")
+	p.Add("c")
+
+	// b and c were seen once, a is frequent.
+	if got, want := p.Keys(), []string{"b", "c", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", got, want)
+	}
+	if key, _ := p.Evict(); key != "b" {
+		t.Errorf("expected b to be evicted, got %v", key)
+	}
+
+	// b is remembered as a ghost and comes back as a frequent key.
+	p.Add("b")
+	if got, want := p.Keys(), []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", got, want)
+	}
+}
+
+func TestARCPolicy(t *testing.T) {
+	p := NewARCPolicy[string](2).(*arcPolicy[string])
+	p.Add("a")
+	p.Add("b")
+	p.Access("a")
+	p.Add("c")
+
+	if key, _ := p.Evict(); key != "b" {
+		t.Errorf("expected b to be evicted, got %v", key)
+	}
+	if !p.b1.contains("b") {
+		t.Errorf("expected b to be remembered in b1")
+	}
+
+	// A hit in b1 grows the target size of t1.
+	p.Remove("c")
+	p.Add("b")
+	if p.p != 1 {
+		t.Errorf("unexpected target: got=%d, want=1", p.p)
+	}
+	if !p.t2.contains("b") {
+		t.Errorf("expected b to be promoted to t2")
+	}
+}
+
+func TestLRUExpireCachePolicies(t *testing.T) {
+	for name, policy := range map[string]PolicyFunc[interface{}]{
+		"lru":  NewLRUPolicy[interface{}],
+		"lfu":  NewLFUPolicy[interface{}],
+		"2q":   NewTwoQueuePolicy[interface{}],
+		"arc":  NewARCPolicy[interface{}],
+		"none": nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var opts []LRUOption
+			if policy != nil {
+				opts = append(opts, WithPolicy(policy))
+			}
+			c := NewLRUExpireCache(4, opts...)
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("elem%d", i)
+				c.Add(key, i, time.Hour)
+				expectEntry(t, c, key, i)
+			}
+			if got := len(c.Keys()); got != 4 {
+				t.Errorf("unexpected number of keys: got=%d, want=4", got)
+			}
+			if got := c.Stats().Evictions; got != 96 {
+				t.Errorf("unexpected evictions: got=%d, want=96", got)
+			}
+		})
+	}
+}
+
+func TestPolicyTypeMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a mismatched policy")
+		}
+	}()
+	NewLRUCache[int, int](4, WithPolicy(NewLFUPolicy[string]))
+}
+
+func TestLRUExpireCacheScanResistance(t *testing.T) {
+	for name, policy := range map[string]PolicyFunc[interface{}]{
+		"lfu": NewLFUPolicy[interface{}],
+		"2q":  NewTwoQueuePolicy[interface{}],
+		"arc": NewARCPolicy[interface{}],
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewLRUExpireCache(8, WithPolicy(policy))
+			hot := []string{"hot1", "hot2", "hot3", "hot4"}
+			for _, key := range hot {
+				c.Add(key, key, time.Hour)
+				expectEntry(t, c, key, key)
+				expectEntry(t, c, key, key)
+			}
+
+			// A full listing touches every key exactly once.
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("scan%d", i)
+				c.Add(key, key, time.Hour)
+			}
+
+			for _, key := range hot {
+				expectEntry(t, c, key, key)
+			}
+		})
+	}
+}
+
+func TestLRUExpireCacheWeightOnlyHistory(t *testing.T) {
+	history := func(p Policy[string]) int {
+		switch p := p.(type) {
+		case *twoQueuePolicy[string]:
+			return p.ghost.len()
+		case *arcPolicy[string]:
+			return p.b1.len() + p.b2.len()
+		}
+		panic(fmt.Sprintf("unexpected policy %T", p))
+	}
+
+	for name, policy := range map[string]PolicyFunc[string]{
+		"2q":  NewTwoQueuePolicy[string],
+		"arc": NewARCPolicy[string],
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewLRUCache[string, int](0, WithPolicy(policy), WithWeigher(10, func(key string, value int) int64 {
+				return 1
+			}))
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("elem%d", i)
+				if err := c.Add(key, i, time.Hour); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if got := len(c.Keys()); got != 10 {
+				t.Errorf("unexpected number of keys: got=%d, want=10", got)
+			}
+			// The evicted keys remembered are bounded by the live keys.
+			if got := history(c.policy); got > 2*10 {
+				t.Errorf("unexpected number of evicted keys remembered: %d", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package cache
+
+import "time"
+
+// rangeEntry is a live entry copied out of a cache for Range.
+type rangeEntry[K comparable, V any] struct {
+	key    K
+	value  V
+	expiry time.Time
+}
+
+func rangeEntries[K comparable, V any](entries []rangeEntry[K, V], f func(key K, value V, expiry time.Time) bool) {
+	for _, e := range entries {
+		if !f(e.key, e.value, e.expiry) {
+			return
+		}
+	}
+}
+
+// Range calls f for every live entry of the cache, in no particular order,
+// until f returns false. The entries are copied under the lock and f is called
+// without it, so f may call back into the cache, and writes made while Range
+// runs may or may not be seen. Range does not count towards the cache
+// statistics and does not restart the ttl of sliding entries.
+func (c *ExpiringCache[K, V]) Range(f func(key K, value V, expiry time.Time) bool) {
+	now := c.clock.Now()
+
+	c.mu.RLock()
+	entries := make([]rangeEntry[K, V], 0, len(c.cache))
+	for key, e := range c.cache {
+		if now.Before(e.expiry) {
+			entries = append(entries, rangeEntry[K, V]{key: key, value: e.val, expiry: e.expiry})
+		}
+	}
+	c.mu.RUnlock()
+
+	rangeEntries(entries, f)
+}
+
+// DeleteFunc deletes every entry, expired or not, for which pred returns true
+// and returns the number of deleted entries. pred is called under the lock,
+// so it must not call back into the cache.
+func (c *ExpiringCache[K, V]) DeleteFunc(pred func(key K, value V) bool) int {
+	var deleted []evictedEntry[K, V]
+	c.mu.Lock()
+	for key, e := range c.cache {
+		if pred(key, e.val) {
+			c.del(key, 0)
+			deleted = append(deleted, evictedEntry[K, V]{key: key, value: e.val, reason: Deleted})
+		}
+	}
+	c.mu.Unlock()
+
+	notifyEvicted(c.onEvict, deleted)
+	return len(deleted)
+}
+
+// Range calls f for every live entry of the cache, from the oldest to the
+// newest as ordered by the policy, until f returns false. The entries are
+// copied under the lock and f is called without it, so f may call back into
+// the cache, and writes made while Range runs may or may not be seen. Range
+// neither updates the recency of the entries nor counts towards the cache
+// statistics.
+func (c *LRUCache[K, V]) Range(f func(key K, value V, expiry time.Time) bool) {
+	now := c.clock.Now()
+
+	c.lock.Lock()
+	entries := make([]rangeEntry[K, V], 0, len(c.entries))
+	for _, key := range c.policy.Keys() {
+		e := c.entries[key]
+		if !now.After(e.expireTime) {
+			entries = append(entries, rangeEntry[K, V]{key: key, value: e.value, expiry: e.expireTime})
+		}
+	}
+	c.lock.Unlock()
+
+	rangeEntries(entries, f)
+}
+
+// DeleteFunc deletes every entry, expired or not, for which pred returns true
+// and returns the number of deleted entries. pred is called under the lock,
+// so it must not call back into the cache.
+func (c *LRUCache[K, V]) DeleteFunc(pred func(key K, value V) bool) int {
+	n := 0
+	c.lock.Lock()
+	for key, e := range c.entries {
+		if pred(key, e.value) {
+			c.policy.Remove(key)
+			c.removeLocked(key, Deleted)
+			n++
+		}
+	}
+	evicted := c.takeEvicted()
+	c.lock.Unlock()
+
+	notifyEvicted(c.onEvict, evicted)
+	return n
+}
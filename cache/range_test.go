@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+func TestExpiringRange(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewExpiringCacheWithClock[string, int](fc)
+	c.Set("a", 1, time.Second)
+	c.Set("b", 2, time.Minute)
+	c.Set("c", 3, time.Minute)
+	fc.Step(time.Second)
+
+	var keys []string
+	c.Range(func(key string, value int, expiry time.Time) bool {
+		if want := fc.Now().Add(59 * time.Second); !expiry.Equal(want) {
+			t.Errorf("unexpected expiry of %s: got=%v, want=%v", key, expiry, want)
+		}
+		// Writers are not blocked while f runs.
+		c.Set("d", 4, time.Minute)
+		keys = append(keys, key)
+		return true
+	})
+	sort.Strings(keys)
+	if want := []string{"b", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", keys, want)
+	}
+
+	n := 0
+	c.Range(func(string, int, time.Time) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("expected Range to stop after the first entry, got %d calls", n)
+	}
+}
+
+func TestExpiringDeleteFunc(t *testing.T) {
+	r := &evictRecorder{}
+	c := NewExpiring(WithEvictFunc(r.onEvict))
+	c.Set("tenant1/a", 1, time.Hour)
+	c.Set("tenant1/b", 2, time.Hour)
+	c.Set("tenant2/a", 3, time.Hour)
+
+	n := c.DeleteFunc(func(key, value interface{}) bool {
+		return strings.HasPrefix(key.(string), "tenant1/")
+	})
+	if n != 2 {
+		t.Errorf("unexpected number of deleted entries: got=%d, want=2", n)
+	}
+	if c.Len() != 1 {
+		t.Errorf("unexpected length: %d", c.Len())
+	}
+	for _, rec := range r.take() {
+		if rec.reason != Deleted {
+			t.Errorf("unexpected reason for %v: %v", rec.key, rec.reason)
+		}
+	}
+}
+
+func TestLRURangeDeleteFunc(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	c := NewLRUCacheWithClock[string, int](4, fakeClock)
+	c.Add("a", 1, time.Second)
+	c.Add("b", 2, time.Hour)
+	c.Add("c", 3, time.Hour)
+	c.Get("b")
+	fakeClock.Step(2 * time.Second)
+
+	var keys []string
+	c.Range(func(key string, value int, expiry time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if want := []string{"c", "b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", keys, want)
+	}
+
+	if n := c.DeleteFunc(func(key string, value int) bool { return value < 3 }); n != 2 {
+		t.Errorf("unexpected number of deleted entries: got=%d, want=2", n)
+	}
+	if got, want := c.Keys(), []string{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected keys: got=%v, want=%v", got, want)
+	}
+}
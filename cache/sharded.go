@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+// NewShardedExpiring returns an initialized sharded expiring cache with the
+// given number of shards.
+func NewShardedExpiring(shards int, opts ...ExpiringOption) *ShardedExpiring {
+	return NewShardedExpiringWithClock(shards, clock.RealClock{}, opts...)
+}
+
+// NewShardedExpiringWithClock is like NewShardedExpiring but allows passing in
+// a custom clock for testing. The options are applied to every shard.
+func NewShardedExpiringWithClock(shards int, clock clock.Clock, opts ...ExpiringOption) *ShardedExpiring {
+	if shards <= 0 {
+		panic(fmt.Sprintf("cache: invalid shard count %d", shards))
+	}
+	c := &ShardedExpiring{
+		shards: make([]*Expiring, shards),
+	}
+	for i := range c.shards {
+		c.shards[i] = NewExpiringWithClock(clock, opts...)
+	}
+	return c
+}
+
+// ShardedExpiring is an expiring cache which spreads its keys over a fixed
+// number of independent Expiring shards. Each shard has its own lock, heap
+// and generation counter, so operations on keys that hash to different shards
+// never contend with each other.
+type ShardedExpiring struct {
+	shards []*Expiring
+}
+
+// Get looks up an entry in the cache.
+func (c *ShardedExpiring) Get(key interface{}) (val interface{}, ok bool) {
+	return c.shard(key).Get(key)
+}
+
+// Set sets a key/value/expiry entry in the map, overwriting any previous entry
+// with the same key. Garbage collection only runs on the shard that owns the
+// key.
+func (c *ShardedExpiring) Set(key interface{}, val interface{}, ttl time.Duration) {
+	c.shard(key).Set(key, val, ttl)
+}
+
+// Delete deletes an entry in the map.
+func (c *ShardedExpiring) Delete(key interface{}) {
+	c.shard(key).Delete(key)
+}
+
+// Len returns the number of items in the cache. The shards are counted one
+// after another, so the result is not an atomic snapshot of the whole cache.
+func (c *ShardedExpiring) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+// Stats returns the sum of the statistics of all shards.
+func (c *ShardedExpiring) Stats() Stats {
+	var s Stats
+	for _, shard := range c.shards {
+		s = s.add(shard.Stats())
+	}
+	return s
+}
+
+// Run starts a janitor for every shard and blocks until stopCh is closed and
+// all of them have returned. See Expiring.Run.
+func (c *ShardedExpiring) Run(stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, s := range c.shards {
+		wg.Add(1)
+		go func(s *Expiring) {
+			defer wg.Done()
+			s.Run(stopCh)
+		}(s)
+	}
+	wg.Wait()
+}
+
+// RunWithContext is like Run but stops the janitors when ctx is done.
+func (c *ShardedExpiring) RunWithContext(ctx context.Context) {
+	c.Run(ctx.Done())
+}
+
+func (c *ShardedExpiring) shard(key interface{}) *Expiring {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	return c.shards[hashKey(key)%uint64(len(c.shards))]
+}
+
+// hashKey returns a hash of key. Equal keys always hash to the same value.
+// Strings and integers are hashed directly, any other key is hashed by walking
+// its value: pointers and channels by address, floats with -0 and +0 equal,
+// and arrays, structs and interfaces by their elements.
+func hashKey(key interface{}) uint64 {
+	switch k := key.(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return mix64(uint64(k))
+	case int8:
+		return mix64(uint64(k))
+	case int16:
+		return mix64(uint64(k))
+	case int32:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case uint:
+		return mix64(uint64(k))
+	case uint8:
+		return mix64(uint64(k))
+	case uint16:
+		return mix64(uint64(k))
+	case uint32:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	case uintptr:
+		return mix64(uint64(k))
+	}
+	return hashValue(reflect.ValueOf(key))
+}
+
+// hashValue hashes the comparable value v consistently with ==. It panics for
+// values which cannot be map keys.
+func hashValue(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.Bool:
+		if v.Bool() {
+			return mix64(1)
+		}
+		return mix64(0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return mix64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return mix64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return hashFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		return mix64(hashFloat(real(c)) ^ hashFloat(imag(c))*31)
+	case reflect.String:
+		return hashString(v.String())
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return mix64(uint64(v.Pointer()))
+	case reflect.Interface:
+		return hashValue(v.Elem())
+	case reflect.Array:
+		var h uint64
+		for i := 0; i < v.Len(); i++ {
+			h = mix64(h*31 + hashValue(v.Index(i)))
+		}
+		return h
+	case reflect.Struct:
+		var h uint64
+		for i := 0; i < v.NumField(); i++ {
+			h = mix64(h*31 + hashValue(v.Field(i)))
+		}
+		return h
+	}
+	panic(fmt.Sprintf("cache: unhashable key type %s", v.Type()))
+}
+
+func hashFloat(f float64) uint64 {
+	if f == 0 {
+		// -0 == +0
+		f = 0
+	}
+	return mix64(math.Float64bits(f))
+}
+
+// hashString is FNV-1a, without the allocation of hash/fnv.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// mix64 is the splitmix64 finalizer. It spreads sequential integers evenly
+// over the shards.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
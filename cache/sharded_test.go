@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+
+	"github.com/google/uuid"
+)
+
+func TestShardedExpiringCache(t *testing.T) {
+	cache := NewShardedExpiring(16)
+
+	if result, ok := cache.Get("foo"); ok || result != nil {
+		t.Errorf("Expected null, false, got %#v, %v", result, ok)
+	}
+
+	cache.Set("foo", "bob", time.Hour)
+	if result, ok := cache.Get("foo"); !ok || result != "bob" {
+		t.Errorf("Expected %#v, true, got %#v, %v", "bob", result, ok)
+	}
+
+	cache.Set("foo", "alice", time.Hour)
+	if result, ok := cache.Get("foo"); !ok || result != "alice" {
+		t.Errorf("Expected %#v, true, got %#v, %v", "alice", result, ok)
+	}
+
+	cache.Delete("foo")
+	if result, ok := cache.Get("foo"); ok || result != nil {
+		t.Errorf("Expected null, false, got %#v, %v", result, ok)
+	}
+}
+
+func TestShardedExpiration(t *testing.T) {
+	fc := &clock.FakeClock{}
+	c := NewShardedExpiringWithClock(4, fc)
+
+	for i := 0; i < 100; i++ {
+		c.Set(i, i, time.Second)
+	}
+	if got := c.Len(); got != 100 {
+		t.Fatalf("unexpected cache size: got=%d, want=100", got)
+	}
+
+	fc.Step(500 * time.Millisecond)
+	if _, ok := c.Get(42); !ok {
+		t.Fatalf("we should have found a key")
+	}
+
+	fc.Step(time.Second)
+	if _, ok := c.Get(42); ok {
+		t.Fatalf("we should not have found a key")
+	}
+
+	// Every shard garbage collects on its own Set, so touch each key once.
+	for i := 0; i < 100; i++ {
+		c.Set(i, i, time.Second)
+		c.Delete(i)
+	}
+	if got := c.Len(); got != 0 {
+		t.Errorf("unexpected cache size: got=%d, want=0", got)
+	}
+}
+
+func TestShardedExpiringDistribution(t *testing.T) {
+	c := NewShardedExpiring(8)
+	for i := 0; i < 8000; i++ {
+		c.Set(uuid.New().String(), struct{}{}, time.Hour)
+	}
+	for i, s := range c.shards {
+		if s.Len() < 500 || s.Len() > 1500 {
+			t.Errorf("shard %d is unbalanced: %d of 8000 entries", i, s.Len())
+		}
+	}
+}
+
+func TestHashKeyStable(t *testing.T) {
+	type compound struct {
+		a string
+		b int
+	}
+	for _, key := range []interface{}{"foo", 1, int64(1), uint8(1), compound{"x", 1}, 1.5} {
+		if hashKey(key) != hashKey(key) {
+			t.Errorf("hashKey(%#v) is not stable", key)
+		}
+	}
+	if hashKey(1) == hashKey(2) {
+		t.Errorf("expected different hashes for different integers")
+	}
+}
+
+func TestHashKeyEqualKeys(t *testing.T) {
+	type compound struct {
+		a string
+		f float64
+		p *int
+	}
+	x := 1
+	negZero := math.Copysign(0, -1)
+	for _, keys := range [][2]interface{}{
+		{0.0, negZero},
+		{compound{"x", 0, &x}, compound{"x", negZero, &x}},
+		{[2]interface{}{"a", 1}, [2]interface{}{"a", 1}},
+		{complex(negZero, 1), complex(0, 1)},
+	} {
+		if keys[0] != keys[1] {
+			t.Fatalf("%#v and %#v are not equal keys", keys[0], keys[1])
+		}
+		if hashKey(keys[0]) != hashKey(keys[1]) {
+			t.Errorf("equal keys %#v and %#v hash differently", keys[0], keys[1])
+		}
+	}
+}
+
+type pointerKey struct {
+	n int
+}
+
+func (k *pointerKey) String() string {
+	return fmt.Sprint(k.n)
+}
+
+func TestShardedExpiringPointerKeys(t *testing.T) {
+	c := NewShardedExpiring(16)
+
+	keys := make([]*pointerKey, 100)
+	for i := range keys {
+		keys[i] = &pointerKey{n: i}
+		c.Set(keys[i], i, time.Hour)
+	}
+	// Mutating the pointees does not change the keys.
+	for _, k := range keys {
+		k.n += 1000
+	}
+	for i, k := range keys {
+		if v, ok := c.Get(k); !ok || v != i {
+			t.Errorf("expected %d, true for key %d, got %v, %v", i, i, v, ok)
+		}
+	}
+}
+
+func BenchmarkShardedExpiringCacheContention(b *testing.B) {
+	const numKeys = 1 << 16
+	cache := NewShardedExpiring(32)
+
+	keys := []string{}
+	for i := 0; i < numKeys; i++ {
+		keys = append(keys, uuid.New().String())
+	}
+
+	b.ResetTimer()
+
+	b.SetParallelism(256)
+	b.RunParallel(func(pb *testing.PB) {
+		rand := rand.New(rand.NewSource(rand.Int63()))
+		for pb.Next() {
+			key := keys[rand.Intn(numKeys)]
+			if _, ok := cache.Get(key); !ok {
+				cache.Set(key, struct{}{}, 50*time.Millisecond)
+			}
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package cache
+
+import "reflect"
+
+// mapHeaderSize is a rough size of the runtime header of a map.
+const mapHeaderSize = 48
+
+// EstimateSize returns an estimate of the number of bytes v occupies in memory,
+// including the memory it points to. Memory reachable more than once through
+// pointers, slices or maps is counted once. The estimate ignores allocator
+// overhead and the spare capacity of maps, so it is a lower bound rather than
+// an exact figure. It walks v with reflection and is not cheap for large
+// values.
+func EstimateSize(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	return int64(rv.Type().Size()) + indirectSize(rv, make(map[uintptr]struct{}))
+}
+
+// indirectSize returns the number of bytes v points to, not counting the
+// bytes of v itself.
+func indirectSize(v reflect.Value, seen map[uintptr]struct{}) int64 {
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Ptr:
+		if v.IsNil() || !markSeen(seen, v.Pointer()) {
+			return 0
+		}
+		e := v.Elem()
+		return int64(e.Type().Size()) + indirectSize(e, seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		e := v.Elem()
+		return int64(e.Type().Size()) + indirectSize(e, seen)
+	case reflect.Slice:
+		if v.IsNil() || !markSeen(seen, v.Pointer()) {
+			return 0
+		}
+		n := int64(v.Cap()) * int64(v.Type().Elem().Size())
+		for i := 0; i < v.Len(); i++ {
+			n += indirectSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Array:
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += indirectSize(v.Index(i), seen)
+		}
+		return n
+	case reflect.Struct:
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += indirectSize(v.Field(i), seen)
+		}
+		return n
+	case reflect.Map:
+		if v.IsNil() || !markSeen(seen, v.Pointer()) {
+			return 0
+		}
+		n := int64(mapHeaderSize)
+		keySize, elemSize := int64(v.Type().Key().Size()), int64(v.Type().Elem().Size())
+		iter := v.MapRange()
+		for iter.Next() {
+			n += keySize + indirectSize(iter.Key(), seen)
+			n += elemSize + indirectSize(iter.Value(), seen)
+		}
+		return n
+	}
+	return 0
+}
+
+// markSeen records p and returns false if it had been recorded before.
+func markSeen(seen map[uintptr]struct{}, p uintptr) bool {
+	if _, ok := seen[p]; ok {
+		return false
+	}
+	seen[p] = struct{}{}
+	return true
+}
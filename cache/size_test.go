@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestEstimateSize(t *testing.T) {
+	if strconv.IntSize != 64 {
+		t.Skip("the expected sizes assume a 64-bit platform")
+	}
+	type node struct {
+		name string
+		next *node
+	}
+	shared := &node{name: "shared"}
+	loop := &node{name: "loop"}
+	loop.next = loop
+
+	for _, tc := range []struct {
+		name string
+		v    interface{}
+		want int64
+	}{
+		{"nil", nil, 0},
+		{"int", 1, 8},
+		{"string", "abcd", 16 + 4},
+		{"bytes", make([]byte, 10, 32), 24 + 32},
+		{"pointer", shared, 8 + 24 + 6},
+		{"cycle", loop, 8 + 24 + 4},
+		{"shared", []*node{shared, shared}, 24 + 2*8 + 24 + 6},
+		{"map", map[string]int{"ab": 1}, 8 + mapHeaderSize + 16 + 2 + 8},
+	} {
+		if got := EstimateSize(tc.v); got != tc.want {
+			t.Errorf("%s: unexpected size: got=%d, want=%d", tc.name, got, tc.want)
+		}
+	}
+}
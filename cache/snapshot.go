@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Encoder writes a stream of values.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads a stream of values written by the matching Encoder.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Codec creates the encoders and decoders used by Snapshot and Restore.
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+var (
+	// GobCodec encodes snapshots with encoding/gob. Concrete types stored
+	// in interface{} keys or values must be registered with gob.Register.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec encodes snapshots with encoding/json. Keys and values are
+	// restored as decoded by json.Unmarshal, so an untyped cache gets back
+	// float64 instead of int and map[string]interface{} instead of structs.
+	JSONCodec Codec = jsonCodec{}
+)
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder { return gob.NewEncoder(w) }
+func (gobCodec) NewDecoder(r io.Reader) Decoder { return gob.NewDecoder(r) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+// snapshotVersion is the version of the snapshot format.
+const snapshotVersion = 1
+
+// snapshotHeader starts a snapshot. It is followed by Count snapshotEntry.
+type snapshotHeader struct {
+	Version int
+	// Time is the time of the cache's clock when the snapshot was taken.
+	Time  time.Time
+	Count int
+}
+
+// snapshotEntry is a single entry of a snapshot.
+type snapshotEntry[K comparable, V any] struct {
+	Key   K
+	Value V
+	// TTL is the time the entry had left when the snapshot was taken.
+	TTL time.Duration
+	// OriginalTTL is the ttl the entry was set with, which an ExpiringCache
+	// with sliding expiration restarts on every read. It is TTL if the cache
+	// does not keep it.
+	OriginalTTL time.Duration
+}
+
+func writeSnapshot[K comparable, V any](w io.Writer, codec Codec, now time.Time, entries []snapshotEntry[K, V]) error {
+	enc := codec.NewEncoder(w)
+	if err := enc.Encode(snapshotHeader{Version: snapshotVersion, Time: now, Count: len(entries)}); err != nil {
+		return err
+	}
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshot decodes a snapshot and calls set for every entry which is
+// still alive at now, with the ttl it has left and the ttl it was set with.
+func readSnapshot[K comparable, V any](r io.Reader, codec Codec, now time.Time, set func(key K, value V, ttl, originalTTL time.Duration)) error {
+	dec := codec.NewDecoder(r)
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("cache: unsupported snapshot version %d", header.Version)
+	}
+	elapsed := now.Sub(header.Time)
+	for i := 0; i < header.Count; i++ {
+		var e snapshotEntry[K, V]
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		// Skip the entries which expired while the snapshot was stored.
+		if ttl := e.TTL - elapsed; ttl > 0 {
+			set(e.Key, e.Value, ttl, e.OriginalTTL)
+		}
+	}
+	return nil
+}
+
+// Snapshot writes every live entry of the cache to w, together with the time
+// it has left to live. The cache is only locked while the entries are
+// collected, not while they are encoded.
+func (c *ExpiringCache[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	now := c.clock.Now()
+
+	c.mu.RLock()
+	entries := make([]snapshotEntry[K, V], 0, len(c.cache))
+	for key, e := range c.cache {
+		if ttl := e.expiry.Sub(now); ttl > 0 {
+			entries = append(entries, snapshotEntry[K, V]{Key: key, Value: e.val, TTL: ttl, OriginalTTL: e.ttl})
+		}
+	}
+	c.mu.RUnlock()
+
+	return writeSnapshot(w, codec, now, entries)
+}
+
+// Restore adds the entries of a snapshot written by Snapshot to the cache.
+// The time between the snapshot and now, as told by the cache's clock, is
+// taken off the ttl of every entry, and the entries which expired in between
+// are skipped. Restored entries overwrite existing entries with the same key.
+// With sliding expiration, reads restart the ttl the entries were originally
+// set with, not the time they had left.
+func (c *ExpiringCache[K, V]) Restore(r io.Reader, codec Codec) error {
+	now := c.clock.Now()
+	return readSnapshot(r, codec, now, func(key K, value V, ttl, originalTTL time.Duration) {
+		c.setExpiry(now, key, value, now.Add(ttl), originalTTL)
+	})
+}
+
+// Snapshot writes every live entry of the cache to w, from the oldest to the
+// newest, together with the time it has left to live. The cache is only
+// locked while the entries are collected, not while they are encoded.
+func (c *LRUCache[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	now := c.clock.Now()
+
+	c.lock.Lock()
+	entries := make([]snapshotEntry[K, V], 0, len(c.entries))
+	for _, key := range c.policy.Keys() {
+		e := c.entries[key]
+		if ttl := e.expireTime.Sub(now); ttl > 0 {
+			entries = append(entries, snapshotEntry[K, V]{Key: key, Value: e.value, TTL: ttl, OriginalTTL: ttl})
+		}
+	}
+	c.lock.Unlock()
+
+	return writeSnapshot(w, codec, now, entries)
+}
+
+// Restore adds the entries of a snapshot written by Snapshot to the cache, in
+// the order they were written so that their recency is kept. The time between
+// the snapshot and now, as told by the cache's clock, is taken off the ttl of
+// every entry, and the entries which expired in between are skipped. Entries
+// rejected with ErrEntryTooLarge are skipped too.
+func (c *LRUCache[K, V]) Restore(r io.Reader, codec Codec) error {
+	return readSnapshot(r, codec, c.clock.Now(), func(key K, value V, ttl, _ time.Duration) {
+		c.Add(key, value, ttl)
+	})
+}
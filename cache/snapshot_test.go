@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+func TestExpiringSnapshotRestore(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GobCodec, "json": JSONCodec} {
+		t.Run(name, func(t *testing.T) {
+			fc := clock.NewFakeClock(time.Now())
+			c := NewExpiringCacheWithClock[string, int](fc)
+			c.Set("short", 1, time.Second)
+			c.Set("long", 2, time.Minute)
+			c.Set("expired", 3, time.Millisecond)
+			fc.Step(time.Millisecond)
+
+			var buf bytes.Buffer
+			if err := c.Snapshot(&buf, codec); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The process is down for two seconds.
+			fc.Step(2 * time.Second)
+			restored := NewExpiringCacheWithClock[string, int](fc)
+			if err := restored.Restore(&buf, codec); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := restored.Len(); got != 1 {
+				t.Errorf("unexpected cache size: got=%d, want=1", got)
+			}
+			if v, ok := restored.Get("long"); !ok || v != 2 {
+				t.Errorf("Expected 2, true, got %d, %v", v, ok)
+			}
+
+			// The entry keeps the ttl it had left.
+			fc.Step(57 * time.Second)
+			if _, ok := restored.Get("long"); !ok {
+				t.Errorf("expected entry to be alive")
+			}
+			fc.Step(time.Second)
+			if _, ok := restored.Get("long"); ok {
+				t.Errorf("expected entry to be expired")
+			}
+		})
+	}
+}
+
+func TestLRUSnapshotRestore(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	c := NewLRUExpireCacheWithClock(3, fakeClock)
+	c.Add("elem1", "1", time.Hour)
+	c.Add("elem2", "2", time.Hour)
+	c.Add("elem3", "3", time.Hour)
+	expectEntry(t, c, "elem1", "1")
+
+	var buf bytes.Buffer
+	if err := c.Snapshot(&buf, GobCodec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	restored := NewLRUExpireCacheWithClock(3, fakeClock)
+	if err := restored.Restore(&buf, GobCodec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Recency survives the round trip, elem2 is still the oldest.
+	restored.Add("elem4", "4", time.Hour)
+	expectNotEntry(t, restored, "elem2")
+	expectEntry(t, restored, "elem1", "1")
+	expectEntry(t, restored, "elem3", "3")
+	expectEntry(t, restored, "elem4", "4")
+}
+
+func TestSlidingSnapshotRestore(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GobCodec, "json": JSONCodec} {
+		t.Run(name, func(t *testing.T) {
+			fc := clock.NewFakeClock(time.Now())
+			c := NewExpiringCacheWithClock[string, int](fc, WithSlidingExpiration())
+			c.Set("session", 1, 30*time.Minute)
+			fc.Step(25 * time.Minute)
+
+			var buf bytes.Buffer
+			if err := c.Snapshot(&buf, codec); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			restored := NewExpiringCacheWithClock[string, int](fc, WithSlidingExpiration())
+			if err := restored.Restore(&buf, codec); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// A read restarts the original 30m, not the 5m which were left.
+			if _, ok := restored.Get("session"); !ok {
+				t.Fatalf("expected entry to be alive")
+			}
+			fc.Step(29 * time.Minute)
+			if _, ok := restored.Get("session"); !ok {
+				t.Errorf("expected entry to be alive")
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsUnknownVersion(t *testing.T) {
+	var buf bytes.Buffer
+	GobCodec.NewEncoder(&buf).Encode(snapshotHeader{Version: snapshotVersion + 1})
+
+	c := NewExpiring()
+	if err := c.Restore(&buf, GobCodec); err == nil {
+		t.Errorf("expected an error for an unknown snapshot version")
+	}
+}
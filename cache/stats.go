@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point in time snapshot of the counters of a cache.
+type Stats struct {
+	// Hits is the number of lookups which found a live entry.
+	Hits uint64
+	// Misses is the number of lookups which found no live entry, including
+	// the ones counted by ExpiredReads.
+	Misses uint64
+	// ExpiredReads is the number of lookups which found an entry that had
+	// already expired but was not garbage collected yet.
+	ExpiredReads uint64
+	// Purged is the number of expired entries removed by garbage collection.
+	Purged uint64
+	// Evictions is the number of live entries removed to respect the
+	// capacity of the cache.
+	Evictions uint64
+	// Size is the number of entries in the cache, expired or not.
+	Size int
+	// Weight is the total weight of the entries in a cache limited by
+	// weight.
+	Weight int64
+
+	// Loads is the number of loader calls made by a LoadingCache.
+	Loads uint64
+	// LoadErrors is the number of loader calls which returned an error.
+	LoadErrors uint64
+	// LoadTime is the total time spent in loader calls.
+	LoadTime time.Duration
+}
+
+// StatsRecorder receives every change to the counters of a cache as it
+// happens. It lets callers bridge cache statistics into their metrics system.
+// Its methods are called on hot paths, possibly under the lock of the cache,
+// so they must be cheap and must not call back into the cache.
+type StatsRecorder interface {
+	RecordHits(n int)
+	RecordMisses(n int)
+	RecordExpiredReads(n int)
+	RecordPurged(n int)
+	RecordEvictions(n int)
+	RecordLoad(d time.Duration, err error)
+}
+
+// statsCounter counts the events of a cache with atomics so that they can be
+// updated under a read lock.
+type statsCounter struct {
+	hits         uint64
+	misses       uint64
+	expiredReads uint64
+	purged       uint64
+	evictions    uint64
+	loads        uint64
+	loadErrors   uint64
+	loadTime     int64
+
+	recorder StatsRecorder
+}
+
+func newStatsCounter(recorder StatsRecorder) *statsCounter {
+	return &statsCounter{recorder: recorder}
+}
+
+func (s *statsCounter) hit() {
+	atomic.AddUint64(&s.hits, 1)
+	if s.recorder != nil {
+		s.recorder.RecordHits(1)
+	}
+}
+
+func (s *statsCounter) miss() {
+	atomic.AddUint64(&s.misses, 1)
+	if s.recorder != nil {
+		s.recorder.RecordMisses(1)
+	}
+}
+
+// expiredRead counts a lookup which found an expired entry, it is a miss too.
+func (s *statsCounter) expiredRead() {
+	atomic.AddUint64(&s.expiredReads, 1)
+	if s.recorder != nil {
+		s.recorder.RecordExpiredReads(1)
+	}
+	s.miss()
+}
+
+func (s *statsCounter) purge(n int) {
+	if n == 0 {
+		return
+	}
+	atomic.AddUint64(&s.purged, uint64(n))
+	if s.recorder != nil {
+		s.recorder.RecordPurged(n)
+	}
+}
+
+func (s *statsCounter) evict(n int) {
+	if n == 0 {
+		return
+	}
+	atomic.AddUint64(&s.evictions, uint64(n))
+	if s.recorder != nil {
+		s.recorder.RecordEvictions(n)
+	}
+}
+
+func (s *statsCounter) load(d time.Duration, err error) {
+	atomic.AddUint64(&s.loads, 1)
+	if err != nil {
+		atomic.AddUint64(&s.loadErrors, 1)
+	}
+	atomic.AddInt64(&s.loadTime, int64(d))
+	if s.recorder != nil {
+		s.recorder.RecordLoad(d, err)
+	}
+}
+
+// snapshot returns the current counters. Size is left for the caller to fill.
+func (s *statsCounter) snapshot() Stats {
+	return Stats{
+		Hits:         atomic.LoadUint64(&s.hits),
+		Misses:       atomic.LoadUint64(&s.misses),
+		ExpiredReads: atomic.LoadUint64(&s.expiredReads),
+		Purged:       atomic.LoadUint64(&s.purged),
+		Evictions:    atomic.LoadUint64(&s.evictions),
+		Loads:        atomic.LoadUint64(&s.loads),
+		LoadErrors:   atomic.LoadUint64(&s.loadErrors),
+		LoadTime:     time.Duration(atomic.LoadInt64(&s.loadTime)),
+	}
+}
+
+// add returns the sum of two snapshots.
+func (s Stats) add(o Stats) Stats {
+	return Stats{
+		Hits:         s.Hits + o.Hits,
+		Misses:       s.Misses + o.Misses,
+		ExpiredReads: s.ExpiredReads + o.ExpiredReads,
+		Purged:       s.Purged + o.Purged,
+		Evictions:    s.Evictions + o.Evictions,
+		Size:         s.Size + o.Size,
+		Weight:       s.Weight + o.Weight,
+		Loads:        s.Loads + o.Loads,
+		LoadErrors:   s.LoadErrors + o.LoadErrors,
+		LoadTime:     s.LoadTime + o.LoadTime,
+	}
+}
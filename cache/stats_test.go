@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+type fakeRecorder struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func newFakeRecorder() *fakeRecorder {
+	return &fakeRecorder{counts: map[string]int{}}
+}
+
+func (r *fakeRecorder) add(name string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[name] += n
+}
+
+func (r *fakeRecorder) RecordHits(n int)         { r.add("hits", n) }
+func (r *fakeRecorder) RecordMisses(n int)       { r.add("misses", n) }
+func (r *fakeRecorder) RecordExpiredReads(n int) { r.add("expiredReads", n) }
+func (r *fakeRecorder) RecordPurged(n int)       { r.add("purged", n) }
+func (r *fakeRecorder) RecordEvictions(n int)    { r.add("evictions", n) }
+func (r *fakeRecorder) RecordLoad(d time.Duration, err error) {
+	r.add("loads", 1)
+	if err != nil {
+		r.add("loadErrors", 1)
+	}
+}
+
+func TestExpiringStats(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	r := newFakeRecorder()
+	c := NewExpiringWithClock(fc, WithStatsRecorder(r))
+
+	c.Set("a", "a", time.Second)
+	c.Set("b", "b", 2*time.Second)
+	c.Get("a")
+	c.Get("missing")
+	fc.Step(time.Second)
+	c.Get("a")
+	c.Set("c", "c", time.Second)
+
+	want := Stats{Hits: 1, Misses: 2, ExpiredReads: 1, Purged: 1, Size: 2}
+	if got := c.Stats(); got != want {
+		t.Errorf("unexpected stats: got=%+v, want=%+v", got, want)
+	}
+	wantRecorded := map[string]int{"hits": 1, "misses": 2, "expiredReads": 1, "purged": 1}
+	for name, n := range wantRecorded {
+		if r.counts[name] != n {
+			t.Errorf("unexpected recorded %s: got=%d, want=%d", name, r.counts[name], n)
+		}
+	}
+}
+
+func TestLRUStats(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	c := NewLRUExpireCacheWithClock(2, fc)
+
+	c.Add("a", "a", time.Second)
+	c.Add("b", "b", time.Hour)
+	c.Add("c", "c", time.Hour)
+	c.Get("a")
+	c.Get("b")
+	fc.Step(2 * time.Hour)
+	c.Get("c")
+	c.Remove("b")
+
+	want := Stats{Hits: 1, Misses: 2, ExpiredReads: 1, Evictions: 1, Size: 0}
+	if got := c.Stats(); got != want {
+		t.Errorf("unexpected stats: got=%+v, want=%+v", got, want)
+	}
+}
+
+func TestShardedStats(t *testing.T) {
+	c := NewShardedExpiring(4)
+	for i := 0; i < 10; i++ {
+		c.Set(i, i, time.Hour)
+		c.Get(i)
+	}
+	c.Get("missing")
+
+	want := Stats{Hits: 10, Misses: 1, Size: 10}
+	if got := c.Stats(); got != want {
+		t.Errorf("unexpected stats: got=%+v, want=%+v", got, want)
+	}
+}
+
+func TestLoadingCacheStats(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	r := newFakeRecorder()
+	c := NewLoadingCache(NewExpiringWithClock(fc), time.Hour, WithStatsRecorder(r))
+
+	loader := func(ctx context.Context, key interface{}) (interface{}, error) {
+		fc.Step(time.Second)
+		if key == "bad" {
+			return nil, errors.New("bad key")
+		}
+		return key, nil
+	}
+	c.GetOrLoad(context.Background(), "good", loader)
+	c.GetOrLoad(context.Background(), "good", loader)
+	c.GetOrLoad(context.Background(), "bad", loader)
+
+	want := Stats{Hits: 1, Misses: 2, Size: 1, Loads: 2, LoadErrors: 1, LoadTime: 2 * time.Second}
+	if got := c.Stats(); got != want {
+		t.Errorf("unexpected stats: got=%+v, want=%+v", got, want)
+	}
+	if r.counts["loads"] != 2 || r.counts["loadErrors"] != 1 {
+		t.Errorf("unexpected recorded loads: %v", r.counts)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+// Backend is a shared store, such as a remote key/value server, which a
+// TieredCache puts an in-memory cache in front of.
+type Backend[K comparable, V any] interface {
+	// Get returns the value of key and the time it has left to live. found is
+	// false if the backend holds no live value for key.
+	Get(ctx context.Context, key K) (value V, ttl time.Duration, found bool, err error)
+	// Set stores the value of key for ttl.
+	Set(ctx context.Context, key K, value V, ttl time.Duration) error
+	// Delete removes the value of key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key K) error
+}
+
+// WriteMode describes how a TieredCache handles writes.
+type WriteMode int
+
+const (
+	// WriteThrough writes to the backend and then to the in-memory cache.
+	WriteThrough WriteMode = iota
+	// WriteAround writes to the backend and drops the key from the in-memory
+	// cache, which is only filled by reads. It suits values which are
+	// written often but rarely read back by the same process.
+	WriteAround
+)
+
+// String returns the name of the mode.
+func (m WriteMode) String() string {
+	switch m {
+	case WriteThrough:
+		return "WriteThrough"
+	case WriteAround:
+		return "WriteAround"
+	}
+	return fmt.Sprintf("WriteMode(%d)", int(m))
+}
+
+// TieredCache puts an in-memory LRUCache, the L1, in front of a Backend, the
+// L2. Reads are served from L1 when possible, and L1 is filled with the values
+// found in L2. The backend is the source of truth: writes go to L2 first, and
+// L1 is only updated once L2 accepted them.
+type TieredCache[K comparable, V any] struct {
+	l1        *LRUCache[K, V]
+	l2        Backend[K, V]
+	writeMode WriteMode
+	// l1TTL caps the ttl of the entries in L1, it is 0 if they keep the ttl
+	// they have in L2.
+	l1TTL time.Duration
+}
+
+// NewTieredCache returns a TieredCache with l1 in front of l2.
+func NewTieredCache[K comparable, V any](l1 *LRUCache[K, V], l2 Backend[K, V], opts ...TieredOption) *TieredCache[K, V] {
+	options := buildTieredOptions(opts)
+	return &TieredCache[K, V]{
+		l1:        l1,
+		l2:        l2,
+		writeMode: options.writeMode,
+		l1TTL:     options.l1TTL,
+	}
+}
+
+// Get returns the value of key, looking in L1 and then in L2. A value found
+// in L2 is added to L1 for the time it has left to live, capped by the L1 ttl.
+func (c *TieredCache[K, V]) Get(ctx context.Context, key K) (value V, found bool, err error) {
+	if value, ok := c.l1.Get(key); ok {
+		return value, true, nil
+	}
+	value, ttl, found, err := c.l2.Get(ctx, key)
+	if err != nil || !found {
+		var zero V
+		return zero, false, err
+	}
+	c.fill(key, value, ttl)
+	return value, true, nil
+}
+
+// Set stores the value of key for ttl in L2, and then updates L1 according to
+// the write mode. If L2 fails, the key is dropped from L1 so that the next
+// read goes to L2.
+func (c *TieredCache[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	if err := c.l2.Set(ctx, key, value, ttl); err != nil {
+		c.l1.Remove(key)
+		return err
+	}
+	if c.writeMode == WriteThrough {
+		c.fill(key, value, ttl)
+	} else {
+		c.l1.Remove(key)
+	}
+	return nil
+}
+
+// Delete removes the value of key from both L1 and L2.
+func (c *TieredCache[K, V]) Delete(ctx context.Context, key K) error {
+	c.l1.Remove(key)
+	return c.l2.Delete(ctx, key)
+}
+
+// fill adds a value to L1 with its ttl capped by the L1 ttl. Values too large
+// for L1 are only kept in L2.
+func (c *TieredCache[K, V]) fill(key K, value V, ttl time.Duration) {
+	if c.l1TTL > 0 && (ttl <= 0 || ttl > c.l1TTL) {
+		ttl = c.l1TTL
+	}
+	if ttl <= 0 {
+		c.l1.Remove(key)
+		return
+	}
+	if err := c.l1.Add(key, value, ttl); err != nil {
+		c.l1.Remove(key)
+	}
+}
+
+// MemoryBackend is a Backend which keeps the values in an ExpiringCache. It is
+// a reference implementation for tests, and a stand-in for a shared store in
+// single process deployments.
+type MemoryBackend[K comparable, V any] struct {
+	c *ExpiringCache[K, V]
+}
+
+var _ Backend[string, string] = &MemoryBackend[string, string]{}
+
+// NewMemoryBackend returns an empty MemoryBackend. The options are passed to
+// the underlying ExpiringCache.
+func NewMemoryBackend[K comparable, V any](opts ...ExpiringOption) *MemoryBackend[K, V] {
+	return NewMemoryBackendWithClock[K, V](clock.RealClock{}, opts...)
+}
+
+// NewMemoryBackendWithClock is like NewMemoryBackend but uses the given clock.
+func NewMemoryBackendWithClock[K comparable, V any](clock clock.Clock, opts ...ExpiringOption) *MemoryBackend[K, V] {
+	return &MemoryBackend[K, V]{c: NewExpiringCacheWithClock[K, V](clock, opts...)}
+}
+
+// Get implements Backend.
+func (b *MemoryBackend[K, V]) Get(ctx context.Context, key K) (value V, ttl time.Duration, found bool, err error) {
+	now := b.c.clock.Now()
+	unlock := b.c.lockForRead()
+	defer unlock()
+	value, found = b.c.getLocked(now, key)
+	if !found {
+		return value, 0, false, nil
+	}
+	return value, b.c.cache[key].expiry.Sub(now), true, nil
+}
+
+// Set implements Backend.
+func (b *MemoryBackend[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	b.c.Set(key, value, ttl)
+	return nil
+}
+
+// Delete implements Backend.
+func (b *MemoryBackend[K, V]) Delete(ctx context.Context, key K) error {
+	b.c.Delete(key)
+	return nil
+}
+
+// Stats returns a snapshot of the statistics of the underlying cache.
+func (b *MemoryBackend[K, V]) Stats() Stats {
+	return b.c.Stats()
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+// failingBackend fails every write with err.
+type failingBackend struct {
+	*MemoryBackend[string, string]
+	err error
+}
+
+func (b failingBackend) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	return b.err
+}
+
+func TestTieredCacheFillsL1(t *testing.T) {
+	ctx := context.Background()
+	fc := clock.NewFakeClock(time.Now())
+	l1 := NewLRUCacheWithClock[string, string](10, fc)
+	l2 := NewMemoryBackendWithClock[string, string](fc)
+	c := NewTieredCache[string, string](l1, l2, WithL1TTL(time.Minute))
+
+	l2.Set(ctx, "a", "1", time.Hour)
+	l2.Set(ctx, "b", "2", time.Second)
+	for _, key := range []string{"a", "a", "b"} {
+		if _, ok, err := c.Get(ctx, key); !ok || err != nil {
+			t.Fatalf("expected %s to be found, got %v, %v", key, ok, err)
+		}
+	}
+	if got := l2.Stats().Hits; got != 2 {
+		t.Errorf("unexpected L2 hits: got=%d, want=2", got)
+	}
+
+	// b keeps the ttl it has in L2, a is capped by the L1 ttl.
+	fc.Step(2 * time.Second)
+	if _, ok := l1.peek("b"); ok {
+		t.Errorf("expected b to expire from L1 with its L2 ttl")
+	}
+	if _, ok := l1.peek("a"); !ok {
+		t.Errorf("expected a to be in L1")
+	}
+	fc.Step(time.Minute)
+	if _, ok := l1.peek("a"); ok {
+		t.Errorf("expected a to expire from L1 with the L1 ttl")
+	}
+	if v, ok, _ := c.Get(ctx, "a"); !ok || v != "1" {
+		t.Errorf("Expected 1, true, got %v, %v", v, ok)
+	}
+
+	if _, ok, err := c.Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("expected a miss, got %v, %v", ok, err)
+	}
+}
+
+func TestTieredCacheWriteModes(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []WriteMode{WriteThrough, WriteAround} {
+		t.Run(mode.String(), func(t *testing.T) {
+			l1 := NewLRUCache[string, string](10)
+			l2 := NewMemoryBackend[string, string]()
+			c := NewTieredCache[string, string](l1, l2, WithWriteMode(mode))
+
+			l1.Add("a", "stale", time.Hour)
+			if err := c.Set(ctx, "a", "1", time.Hour); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			v, inL1 := l1.peek("a")
+			if inL1 != (mode == WriteThrough) {
+				t.Errorf("unexpected presence in L1: %v", inL1)
+			}
+			if inL1 && v != "1" {
+				t.Errorf("unexpected L1 value: %v", v)
+			}
+			if v, _, ok, _ := l2.Get(ctx, "a"); !ok || v != "1" {
+				t.Errorf("Expected 1, true, got %v, %v", v, ok)
+			}
+
+			if err := c.Delete(ctx, "a"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok, _ := c.Get(ctx, "a"); ok {
+				t.Errorf("expected a to be deleted")
+			}
+		})
+	}
+}
+
+func TestTieredCacheBackendError(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("backend down")
+	l1 := NewLRUCache[string, string](10)
+	c := NewTieredCache[string, string](l1, failingBackend{NewMemoryBackend[string, string](), errDown})
+
+	l1.Add("a", "stale", time.Hour)
+	if err := c.Set(ctx, "a", "1", time.Hour); err != errDown {
+		t.Errorf("expected backend error, got %v", err)
+	}
+	if _, ok := l1.peek("a"); ok {
+		t.Errorf("expected a to be dropped from L1")
+	}
+}
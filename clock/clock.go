@@ -17,6 +17,7 @@ limitations under the License.
 package clock
 
 import (
+	"runtime"
 	"sync"
 	"time"
 )
@@ -37,6 +38,7 @@ type Clock interface {
 	NewTimer(time.Duration) Timer
 	Sleep(time.Duration)
 	NewTicker(time.Duration) Ticker
+	AfterFunc(time.Duration, func()) Timer
 }
 
 // RealClock really calls time.Now()
@@ -71,6 +73,14 @@ func (RealClock) NewTicker(d time.Duration) Ticker {
 	}
 }
 
+// AfterFunc is the same as time.AfterFunc(d, f). The channel of the returned
+// Timer is nil.
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &realTimer{
+		timer: time.AfterFunc(d, f),
+	}
+}
+
 // Sleep pauses the RealClock for duration d.
 func (RealClock) Sleep(d time.Duration) {
 	time.Sleep(d)
@@ -88,6 +98,17 @@ type FakeClock struct {
 
 	// waiters are waiting for the fake time to pass their specified time
 	waiters []fakeClockWaiter
+	// waitersChanged is signaled whenever waiters changes. It is created
+	// by the first call to BlockUntilWaiters.
+	waitersChanged *sync.Cond
+	// autoAdvance is the number of waiters at which the clock steps to
+	// the time of the earliest waiter, 0 if it never does.
+	autoAdvance int
+	// version is incremented whenever waiters changes.
+	version uint64
+	// onFire is called for every waiter which fires, it is set by a
+	// Simulation to record its trace.
+	onFire func(w *fakeClockWaiter, t time.Time)
 }
 
 type fakeClockWaiter struct {
@@ -95,6 +116,14 @@ type fakeClockWaiter struct {
 	stepInterval  time.Duration
 	skipIfBlocked bool
 	destChan      chan time.Time
+	// afterFunc is called in its own goroutine instead of sending on
+	// destChan, which then only identifies the waiter.
+	afterFunc func()
+	// kind is the name of the method which created the waiter.
+	kind string
+	// caller is the function which armed the waiter, it is only set while
+	// onFire is set.
+	caller string
 }
 
 // NewFakePassiveClock returns a new FakePassiveClock.
@@ -138,9 +167,10 @@ func (f *FakeClock) After(d time.Duration) <-chan time.Time {
 	defer f.lock.Unlock()
 	stopTime := f.time.Add(d)
 	ch := make(chan time.Time, 1) // Don't block!
-	f.waiters = append(f.waiters, fakeClockWaiter{
+	f.addWaiterLocked(fakeClockWaiter{
 		targetTime: stopTime,
 		destChan:   ch,
+		kind:       "After",
 	})
 	return ch
 }
@@ -156,9 +186,30 @@ func (f *FakeClock) NewTimer(d time.Duration) Timer {
 		waiter: fakeClockWaiter{
 			targetTime: stopTime,
 			destChan:   ch,
+			kind:       "Timer",
+		},
+	}
+	f.addWaiterLocked(timer.waiter)
+	return timer
+}
+
+// AfterFunc is the Fake version of time.AfterFunc(d, f). afterFunc runs in
+// its own goroutine once the clock is stepped past d. The channel of the
+// returned Timer is nil.
+func (f *FakeClock) AfterFunc(d time.Duration, afterFunc func()) Timer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	stopTime := f.time.Add(d)
+	timer := &fakeTimer{
+		fakeClock: f,
+		waiter: fakeClockWaiter{
+			targetTime: stopTime,
+			destChan:   make(chan time.Time),
+			afterFunc:  afterFunc,
+			kind:       "AfterFunc",
 		},
 	}
-	f.waiters = append(f.waiters, timer.waiter)
+	f.addWaiterLocked(timer.waiter)
 	return timer
 }
 
@@ -168,16 +219,18 @@ func (f *FakeClock) NewTicker(d time.Duration) Ticker {
 	defer f.lock.Unlock()
 	tickTime := f.time.Add(d)
 	ch := make(chan time.Time, 1) // hold one tick
-	f.waiters = append(f.waiters, fakeClockWaiter{
-		targetTime:    tickTime,
-		stepInterval:  d,
-		skipIfBlocked: true,
-		destChan:      ch,
-	})
-
-	return &fakeTicker{
-		c: ch,
+	ticker := &fakeTicker{
+		fakeClock: f,
+		waiter: fakeClockWaiter{
+			targetTime:    tickTime,
+			stepInterval:  d,
+			skipIfBlocked: true,
+			destChan:      ch,
+			kind:          "Ticker",
+		},
 	}
+	f.addWaiterLocked(ticker.waiter)
+	return ticker
 }
 
 // Step moves clock by Duration, notifies anyone that's called After, Tick, or NewTimer
@@ -202,7 +255,12 @@ func (f *FakeClock) setTimeLocked(t time.Time) {
 		w := &f.waiters[i]
 		if !w.targetTime.After(t) {
 
-			if w.skipIfBlocked {
+			if f.onFire != nil {
+				f.onFire(w, t)
+			}
+			if w.afterFunc != nil {
+				go w.afterFunc()
+			} else if w.skipIfBlocked {
 				select {
 				case w.destChan <- t:
 				default:
@@ -223,6 +281,68 @@ func (f *FakeClock) setTimeLocked(t time.Time) {
 		}
 	}
 	f.waiters = newWaiters
+	f.waitersChangedLocked()
+}
+
+// removeWaiterLocked removes the waiter which sends on destChan and returns
+// true if there was one. Waiters are identified by the identity of their
+// destination channel, nothing else is necessarily unique and constant since
+// their creation. f must be write-locked.
+func (f *FakeClock) removeWaiterLocked(destChan chan time.Time) bool {
+	removed := false
+	newWaiters := make([]fakeClockWaiter, 0, len(f.waiters))
+	for i := range f.waiters {
+		if f.waiters[i].destChan == destChan {
+			removed = true
+		} else {
+			newWaiters = append(newWaiters, f.waiters[i])
+		}
+	}
+	f.waiters = newWaiters
+	f.waitersChangedLocked()
+	return removed
+}
+
+// addWaiterLocked registers w and steps the clock if auto-advance is on and
+// enough waiters are registered. f must be write-locked.
+func (f *FakeClock) addWaiterLocked(w fakeClockWaiter) {
+	if f.onFire != nil {
+		// Skip addWaiterLocked and the method of f which called it.
+		if pc, _, _, ok := runtime.Caller(2); ok {
+			w.caller = runtime.FuncForPC(pc).Name()
+		}
+	}
+	f.waiters = append(f.waiters, w)
+	f.waitersChangedLocked()
+	f.autoAdvanceLocked()
+}
+
+// waitersChangedLocked wakes up the callers of BlockUntilWaiters. f must be
+// write-locked.
+func (f *FakeClock) waitersChangedLocked() {
+	f.version++
+	if f.waitersChanged != nil {
+		f.waitersChanged.Broadcast()
+	}
+}
+
+// autoAdvanceLocked steps the clock to the time of the earliest waiter if
+// at least autoAdvance waiters are registered. It steps once, so that a
+// ticker alone cannot make the clock run away. f must be write-locked.
+func (f *FakeClock) autoAdvanceLocked() {
+	if f.autoAdvance <= 0 || len(f.waiters) < f.autoAdvance {
+		return
+	}
+	next := f.waiters[0].targetTime
+	for _, w := range f.waiters[1:] {
+		if w.targetTime.Before(next) {
+			next = w.targetTime
+		}
+	}
+	if next.Before(f.time) {
+		next = f.time
+	}
+	f.setTimeLocked(next)
 }
 
 // HasWaiters returns true if After has been called on f but not yet satisfied (so you can
@@ -233,49 +353,121 @@ func (f *FakeClock) HasWaiters() bool {
 	return len(f.waiters) > 0
 }
 
+// WaitersCount returns the number of timers, tickers and After channels
+// which are waiting for the fake time to pass their time.
+func (f *FakeClock) WaitersCount() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return len(f.waiters)
+}
+
+// BlockUntilWaiters blocks until at least n waiters are registered on f, so
+// that a test can wait for the goroutine under test to arm its timer before
+// calling Step.
+func (f *FakeClock) BlockUntilWaiters(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.waitersChanged == nil {
+		f.waitersChanged = sync.NewCond(&f.lock)
+	}
+	for len(f.waiters) < n {
+		f.waitersChanged.Wait()
+	}
+}
+
+// SetAutoAdvance makes f step to the time of its earliest waiter whenever a
+// waiter is registered and at least n waiters are registered, that is once
+// the n goroutines under test are all blocked on f. A test then runs through
+// its timers without calling Step. n <= 0 turns auto-advance off.
+func (f *FakeClock) SetAutoAdvance(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.autoAdvance = n
+	f.autoAdvanceLocked()
+}
+
 // Sleep pauses the FakeClock for duration d.
 func (f *FakeClock) Sleep(d time.Duration) {
 	f.Step(d)
 }
 
-// IntervalClock implements Clock, but each invocation of Now steps the clock forward the specified duration
+// IntervalClock implements Clock, but each invocation of Now steps the clock forward the specified duration.
+// Timers and tickers are scheduled like on a FakeClock and fire once the steps of Now or Sleep reach them.
+// Time may be changed directly between calls, waiters are checked against it by the next call.
 type IntervalClock struct {
 	Time     time.Time
 	Duration time.Duration
+
+	// lock protects Time and fake during calls
+	lock sync.Mutex
+	// fake holds the waiters of the clock, it is created by the first call
+	// which needs it.
+	fake *FakeClock
 }
 
 // Now returns i's time.
 func (i *IntervalClock) Now() time.Time {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	i.Time = i.Time.Add(i.Duration)
+	if i.fake != nil {
+		i.fake.SetTime(i.Time)
+	}
 	return i.Time
 }
 
 // Since returns time since the time in i.
 func (i *IntervalClock) Since(ts time.Time) time.Duration {
+	i.lock.Lock()
+	defer i.lock.Unlock()
 	return i.Time.Sub(ts)
 }
 
-// After is currently unimplemented, will panic.
-// TODO: make interval clock use FakeClock so this can be implemented.
-func (*IntervalClock) After(d time.Duration) <-chan time.Time {
-	panic("IntervalClock doesn't implement After")
+// After is the Fake version of time.After(d), measured from the time in i.
+func (i *IntervalClock) After(d time.Duration) <-chan time.Time {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.fakeLocked().After(d)
 }
 
-// NewTimer is currently unimplemented, will panic.
-// TODO: make interval clock use FakeClock so this can be implemented.
-func (*IntervalClock) NewTimer(d time.Duration) Timer {
-	panic("IntervalClock doesn't implement NewTimer")
+// NewTimer is the Fake version of time.NewTimer(d), measured from the time in i.
+func (i *IntervalClock) NewTimer(d time.Duration) Timer {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.fakeLocked().NewTimer(d)
 }
 
-// NewTicker is currently unimplemented, will panic.
-// TODO: make interval clock use FakeClock so this can be implemented.
-func (*IntervalClock) NewTicker(d time.Duration) Ticker {
-	panic("IntervalClock doesn't implement NewTicker")
+// NewTicker returns a new Ticker, measured from the time in i.
+func (i *IntervalClock) NewTicker(d time.Duration) Ticker {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.fakeLocked().NewTicker(d)
 }
 
-// Sleep is currently unimplemented; will panic.
-func (*IntervalClock) Sleep(d time.Duration) {
-	panic("IntervalClock doesn't implement Sleep")
+// AfterFunc is the Fake version of time.AfterFunc(d, f), measured from the time in i.
+func (i *IntervalClock) AfterFunc(d time.Duration, f func()) Timer {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	return i.fakeLocked().AfterFunc(d, f)
+}
+
+// Sleep steps the IntervalClock forward by d, firing the waiters it passes.
+func (i *IntervalClock) Sleep(d time.Duration) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.Time = i.Time.Add(d)
+	i.fakeLocked()
+}
+
+// fakeLocked returns the FakeClock which schedules the waiters of i, with
+// its time set to the time in i. i must be locked.
+func (i *IntervalClock) fakeLocked() *FakeClock {
+	if i.fake == nil {
+		i.fake = NewFakeClock(i.Time)
+	} else if !i.fake.Now().Equal(i.Time) {
+		i.fake.SetTime(i.Time)
+	}
+	return i.fake
 }
 
 // Timer allows for injecting fake or real timers into code that
@@ -312,8 +504,12 @@ type fakeTimer struct {
 	waiter    fakeClockWaiter
 }
 
-// C returns the channel that notifies when this timer has fired.
+// C returns the channel that notifies when this timer has fired, it is nil
+// for a timer created by AfterFunc.
 func (f *fakeTimer) C() <-chan time.Time {
+	if f.waiter.afterFunc != nil {
+		return nil
+	}
 	return f.waiter.destChan
 }
 
@@ -325,24 +521,7 @@ func (f *fakeTimer) Stop() bool {
 	defer f.fakeClock.lock.Unlock()
 	// The timer has already fired or been stopped, unless it is found
 	// among the clock's waiters.
-	stopped := false
-	oldWaiters := f.fakeClock.waiters
-	newWaiters := make([]fakeClockWaiter, 0, len(oldWaiters))
-	seekChan := f.waiter.destChan
-	for i := range oldWaiters {
-		// Identify the timer's fakeClockWaiter by the identity of the
-		// destination channel, nothing else is necessarily unique and
-		// constant since the timer's creation.
-		if oldWaiters[i].destChan == seekChan {
-			stopped = true
-		} else {
-			newWaiters = append(newWaiters, oldWaiters[i])
-		}
-	}
-
-	f.fakeClock.waiters = newWaiters
-
-	return stopped
+	return f.fakeClock.removeWaiterLocked(f.waiter.destChan)
 }
 
 // Reset conditionally updates the firing time of the timer.  If the
@@ -363,17 +542,17 @@ func (f *fakeTimer) Reset(d time.Duration) bool {
 	for i := range waiters {
 		if waiters[i].destChan == seekChan {
 			waiters[i].targetTime = f.fakeClock.time.Add(d)
+			f.fakeClock.waitersChangedLocked()
+			f.fakeClock.autoAdvanceLocked()
 			return true
 		}
 	}
 	// No existing waiter, timer has already fired or been reset.
 	// We should still enable Reset() to succeed by creating a
 	// new waiter and adding it to the clock's waiters.
-	newWaiter := fakeClockWaiter{
-		targetTime: f.fakeClock.time.Add(d),
-		destChan:   seekChan,
-	}
-	f.fakeClock.waiters = append(f.fakeClock.waiters, newWaiter)
+	newWaiter := f.waiter
+	newWaiter.targetTime = f.fakeClock.time.Add(d)
+	f.fakeClock.addWaiterLocked(newWaiter)
 	return true
 }
 
@@ -381,6 +560,7 @@ func (f *fakeTimer) Reset(d time.Duration) bool {
 type Ticker interface {
 	C() <-chan time.Time
 	Stop()
+	Reset(d time.Duration)
 }
 
 type realTicker struct {
@@ -395,13 +575,40 @@ func (t *realTicker) Stop() {
 	t.ticker.Stop()
 }
 
+func (t *realTicker) Reset(d time.Duration) {
+	t.ticker.Reset(d)
+}
+
+// fakeTicker implements Ticker based on a FakeClock.
 type fakeTicker struct {
-	c <-chan time.Time
+	fakeClock *FakeClock
+	waiter    fakeClockWaiter
 }
 
 func (t *fakeTicker) C() <-chan time.Time {
-	return t.c
+	return t.waiter.destChan
 }
 
+// Stop turns off the ticker, no more ticks are sent. Like time.Ticker::Stop,
+// it does not close the channel, so a tick sent before Stop may still be
+// received.
 func (t *fakeTicker) Stop() {
+	t.fakeClock.lock.Lock()
+	defer t.fakeClock.lock.Unlock()
+	t.fakeClock.removeWaiterLocked(t.waiter.destChan)
+}
+
+// Reset stops the ticker and resets its period to d. The next tick arrives
+// after d has elapsed on the fake clock, even if the ticker was stopped.
+// Like time.Ticker::Reset, it panics if d is not positive.
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.fakeClock.lock.Lock()
+	defer t.fakeClock.lock.Unlock()
+	t.fakeClock.removeWaiterLocked(t.waiter.destChan)
+	t.waiter.targetTime = t.fakeClock.time.Add(d)
+	t.waiter.stepInterval = d
+	t.fakeClock.addWaiterLocked(t.waiter)
 }
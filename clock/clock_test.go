@@ -25,12 +25,16 @@ var (
 	_ = Clock(RealClock{})
 	_ = Clock(&FakeClock{})
 	_ = Clock(&IntervalClock{})
+	_ = Clock(&MonotonicClock{})
+	_ = Clock(&ScaledClock{})
 
 	_ = Timer(&realTimer{})
 	_ = Timer(&fakeTimer{})
+	_ = Timer(&scaledTimer{})
 
 	_ = Ticker(&realTicker{})
 	_ = Ticker(&fakeTicker{})
+	_ = Ticker(&scaledTicker{})
 )
 
 type SettablePassiveClock interface {
@@ -327,3 +331,253 @@ func TestFakeTick(t *testing.T) {
 		t.Errorf("unexpected number of accumulated ticks: %d", accumulatedTicks)
 	}
 }
+
+func TestFakeClockBlockUntilWaiters(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := fc.NewTimer(time.Second)
+		<-fc.After(2 * time.Second)
+		<-timer.C()
+	}()
+
+	fc.BlockUntilWaiters(2)
+	if got := fc.WaitersCount(); got != 2 {
+		t.Errorf("unexpected waiters: got=%d, want=2", got)
+	}
+	fc.Step(2 * time.Second)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("goroutine did not return")
+	}
+	if got := fc.WaitersCount(); got != 0 {
+		t.Errorf("unexpected waiters: got=%d, want=0", got)
+	}
+}
+
+func TestFakeClockAutoAdvance(t *testing.T) {
+	start := time.Now()
+	fc := NewFakeClock(start)
+	fc.SetAutoAdvance(1)
+
+	// Every wait fires as soon as it is armed, in virtual time.
+	timer := fc.NewTimer(time.Hour)
+	<-timer.C()
+	for i := 0; i < 3; i++ {
+		<-fc.After(time.Minute)
+	}
+	timer.Reset(time.Second)
+	<-timer.C()
+	if got, want := fc.Since(start), time.Hour+3*time.Minute+time.Second; got != want {
+		t.Errorf("unexpected elapsed time: got=%v, want=%v", got, want)
+	}
+
+	// With two waiters, the clock waits for both to be armed and then runs
+	// to the earliest deadline only.
+	fc.SetAutoAdvance(2)
+	now := fc.Now()
+	ticker := fc.NewTicker(time.Second)
+	if fc.Since(now) != 0 {
+		t.Errorf("unexpected step with a single waiter")
+	}
+	after := fc.After(10 * time.Second)
+	<-ticker.C()
+	if got := fc.Since(now); got != time.Second {
+		t.Errorf("unexpected elapsed time: got=%v, want=%v", got, time.Second)
+	}
+	select {
+	case <-after:
+		t.Errorf("unexpected channel read")
+	default:
+	}
+
+	fc.SetAutoAdvance(0)
+	ch := fc.After(time.Second)
+	select {
+	case <-ch:
+		t.Errorf("unexpected channel read with auto-advance off")
+	default:
+	}
+}
+
+func TestFakeAfterFunc(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+	fired := make(chan struct{}, 2)
+	timer := fc.AfterFunc(time.Second, func() { fired <- struct{}{} })
+	if timer.C() != nil {
+		t.Errorf("expected a nil channel for AfterFunc")
+	}
+
+	fc.Step(999 * time.Millisecond)
+	select {
+	case <-fired:
+		t.Fatalf("unexpected call before the deadline")
+	case <-time.After(10 * time.Millisecond):
+	}
+	fc.Step(time.Millisecond)
+	select {
+	case <-fired:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected a call at the deadline")
+	}
+
+	// A reset timer runs its func again, a stopped one does not.
+	timer.Reset(time.Second)
+	fc.Step(time.Second)
+	<-fired
+	timer.Reset(time.Second)
+	if !timer.Stop() {
+		t.Errorf("expected Stop to stop a pending timer")
+	}
+	fc.Step(time.Second)
+	select {
+	case <-fired:
+		t.Errorf("unexpected call of a stopped timer")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestRealAfterFunc(t *testing.T) {
+	fired := make(chan struct{})
+	RealClock{}.AfterFunc(time.Millisecond, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected AfterFunc to run")
+	}
+}
+
+func TestFakeTickerStopReset(t *testing.T) {
+	tc := NewFakeClock(time.Now())
+	ticker := tc.NewTicker(time.Second)
+	ticker.Stop()
+	if tc.HasWaiters() {
+		t.Errorf("expected Stop to remove the waiter")
+	}
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+		t.Errorf("unexpected tick of a stopped ticker")
+	default:
+	}
+
+	// Reset restarts a stopped ticker with the new period.
+	ticker.Reset(2 * time.Second)
+	if got := tc.WaitersCount(); got != 1 {
+		t.Errorf("unexpected waiters: got=%d, want=1", got)
+	}
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+		t.Errorf("unexpected tick before the new period")
+	default:
+	}
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+	default:
+		t.Errorf("expected a tick after the new period")
+	}
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+		t.Errorf("unexpected tick in the middle of a period")
+	default:
+	}
+	tc.Step(time.Second)
+	select {
+	case <-ticker.C():
+	default:
+		t.Errorf("expected a tick after two periods")
+	}
+
+	// Reset of a running ticker does not add a waiter.
+	ticker.Reset(time.Second)
+	if got := tc.WaitersCount(); got != 1 {
+		t.Errorf("unexpected waiters: got=%d, want=1", got)
+	}
+}
+
+func TestRealTickerReset(t *testing.T) {
+	ticker := RealClock{}.NewTicker(time.Hour)
+	defer ticker.Stop()
+	ticker.Reset(time.Millisecond)
+	select {
+	case <-ticker.C():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected a tick after Reset")
+	}
+}
+
+func TestIntervalClock(t *testing.T) {
+	start := time.Now()
+	ic := &IntervalClock{Time: start, Duration: time.Second}
+	if got := ic.Now(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("unexpected time: got=%v, want=%v", got, start.Add(time.Second))
+	}
+
+	after := ic.After(2 * time.Second)
+	timer := ic.NewTimer(3 * time.Second)
+	ticker := ic.NewTicker(time.Second)
+	defer ticker.Stop()
+	fired := make(chan struct{})
+	ic.AfterFunc(time.Second, func() { close(fired) })
+
+	ic.Now()
+	<-fired
+	<-ticker.C()
+	select {
+	case <-after:
+		t.Errorf("unexpected channel read")
+	default:
+	}
+
+	ic.Now()
+	<-after
+	<-ticker.C()
+
+	// Sleep steps the clock too.
+	ic.Sleep(time.Second)
+	<-timer.C()
+	if got := ic.Since(start); got != 4*time.Second {
+		t.Errorf("unexpected elapsed time: got=%v, want=%v", got, 4*time.Second)
+	}
+
+	// Changing the field directly still works, waiters follow it.
+	ic.Time = ic.Time.Add(time.Hour)
+	ic.Now()
+	select {
+	case <-ticker.C():
+	default:
+		t.Errorf("expected a tick after moving the time")
+	}
+}
+
+func TestIntervalClockAfterFunc(t *testing.T) {
+	ic := &IntervalClock{Time: time.Now(), Duration: time.Second}
+
+	stoppedFired := make(chan struct{})
+	stopped := ic.AfterFunc(time.Second, func() { close(stoppedFired) })
+	fired := make(chan struct{})
+	timer := ic.AfterFunc(2*time.Second, func() { close(fired) })
+	if timer.C() != nil {
+		t.Errorf("expected a nil channel for AfterFunc")
+	}
+	if !stopped.Stop() {
+		t.Errorf("expected Stop to stop a pending AfterFunc")
+	}
+
+	ic.Now()
+	ic.Now()
+	<-fired
+	if timer.Stop() {
+		t.Errorf("expected Stop to report the AfterFunc as fired")
+	}
+	select {
+	case <-stoppedFired:
+		t.Errorf("unexpected call of a stopped AfterFunc")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,106 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithDeadline is like context.WithDeadline, but the deadline is measured by
+// c. With a FakeClock, the returned context is done once the clock is stepped
+// to or past d. Calling cancel releases the timer of the context, so it
+// should be called as soon as the operation running in the context is done.
+func WithDeadline(parent context.Context, c Clock, d time.Time) (context.Context, context.CancelFunc) {
+	ctx := &deadlineContext{
+		parent:   parent,
+		deadline: d,
+		done:     make(chan struct{}),
+	}
+	if err := parent.Err(); err != nil {
+		ctx.cancel(err)
+		return ctx, func() {}
+	}
+	timeout := d.Sub(c.Now())
+	if timeout <= 0 {
+		ctx.cancel(context.DeadlineExceeded)
+		return ctx, func() {}
+	}
+
+	timer := c.AfterFunc(timeout, func() {
+		ctx.cancel(context.DeadlineExceeded)
+	})
+	if parent.Done() != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+				timer.Stop()
+				ctx.cancel(parent.Err())
+			case <-ctx.done:
+			}
+		}()
+	}
+	return ctx, func() {
+		timer.Stop()
+		ctx.cancel(context.Canceled)
+	}
+}
+
+// WithTimeout returns WithDeadline(parent, c, c.Now().Add(timeout)).
+func WithTimeout(parent context.Context, c Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return WithDeadline(parent, c, c.Now().Add(timeout))
+}
+
+// deadlineContext is a context which is done when its parent is done, when
+// it is canceled, or when its deadline passes. It does not embed a context
+// created by the context package, so contexts derived from it see its own
+// error, including context.DeadlineExceeded.
+type deadlineContext struct {
+	parent   context.Context
+	deadline time.Time
+	done     chan struct{}
+
+	// mu protects err
+	mu sync.Mutex
+	// err is set when done is closed.
+	err error
+}
+
+// cancel sets the error of the context and closes its done channel, unless
+// the context is done already.
+func (c *deadlineContext) cancel(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// Deadline returns the deadline of the context, or the deadline of the parent
+// if that one is earlier.
+func (c *deadlineContext) Deadline() (time.Time, bool) {
+	if d, ok := c.parent.Deadline(); ok && d.Before(c.deadline) {
+		return d, true
+	}
+	return c.deadline, true
+}
+
+// Done returns a channel which is closed when the context is done.
+func (c *deadlineContext) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns nil until the context is done, and then the error of the parent
+// if the parent was done first, context.DeadlineExceeded if the deadline
+// passed and context.Canceled if the context was canceled.
+func (c *deadlineContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Value returns the value of the parent for key.
+func (c *deadlineContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
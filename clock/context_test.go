@@ -0,0 +1,108 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+	ctx, cancel := WithTimeout(context.Background(), fc, time.Minute)
+	defer cancel()
+
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(fc.Now().Add(time.Minute)) {
+		t.Errorf("unexpected deadline: %v, %v", d, ok)
+	}
+	fc.Step(59 * time.Second)
+	select {
+	case <-ctx.Done():
+		t.Fatalf("unexpected done before the deadline")
+	default:
+	}
+	if ctx.Err() != nil {
+		t.Errorf("unexpected error: %v", ctx.Err())
+	}
+
+	fc.Step(time.Second)
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected done at the deadline")
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", ctx.Err())
+	}
+}
+
+func TestWithDeadlineCancel(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := WithDeadline(parent, fc, fc.Now().Add(time.Minute))
+	defer cancel()
+
+	cancelParent()
+	<-ctx.Done()
+	if ctx.Err() != context.Canceled {
+		t.Errorf("expected Canceled, got %v", ctx.Err())
+	}
+
+	// cancel releases the timer of the context.
+	cancel()
+	if fc.HasWaiters() {
+		t.Errorf("expected the timer to be stopped")
+	}
+
+	// A deadline in the past is exceeded right away.
+	ctx, cancel = WithDeadline(context.Background(), fc, fc.Now())
+	defer cancel()
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", ctx.Err())
+	}
+}
+
+func TestWithDeadlineDerived(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+	ctx, cancel := WithTimeout(context.Background(), fc, time.Minute)
+	defer cancel()
+	child, cancelChild := context.WithCancel(ctx)
+	defer cancelChild()
+
+	select {
+	case <-child.Done():
+		t.Fatalf("unexpected done before the deadline")
+	default:
+	}
+	if child.Err() != nil {
+		t.Errorf("unexpected error: %v", child.Err())
+	}
+
+	fc.Step(time.Minute)
+	select {
+	case <-child.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the derived context to be done at the deadline")
+	}
+	if child.Err() != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", child.Err())
+	}
+}
+
+func TestWithDeadlineParentDeadline(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+	parent, cancelParent := context.WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	defer cancelParent()
+	parentDeadline, _ := parent.Deadline()
+
+	ctx, cancel := WithTimeout(parent, fc, 2*time.Hour)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(parentDeadline) {
+		t.Errorf("expected the earlier deadline of the parent, got %v, %v", d, ok)
+	}
+
+	ctx, cancel = WithTimeout(parent, fc, time.Minute)
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(fc.Now().Add(time.Minute)) {
+		t.Errorf("unexpected deadline: %v, %v", d, ok)
+	}
+}
@@ -0,0 +1,145 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// JumpHandler is called with the size of a wall clock jump, positive if the
+// wall clock jumped forward and negative if it jumped back.
+type JumpHandler func(jump time.Duration)
+
+// MonotonicClock implements Clock with time that never jumps. Now returns the
+// wall time at which the clock was created plus the monotonic time elapsed
+// since, so expiry times and backoffs computed from it are not disturbed when
+// NTP steps the wall clock. The drift between the wall clock and the
+// monotonic clock is checked on every call to Now and Since, and a change of
+// the drift beyond a threshold is reported to the registered JumpHandlers.
+// Slow drift, such as NTP slewing, is not reported.
+type MonotonicClock struct {
+	threshold time.Duration
+	// start is the wall time at which the clock was created.
+	start time.Time
+	// wall and mono read the wall clock and the monotonic time elapsed
+	// since the clock was created, they are replaced in tests.
+	wall func() time.Time
+	mono func() time.Duration
+
+	// mu protects the below fields
+	mu sync.Mutex
+	// offset is the drift of the wall clock seen by the last check.
+	offset   time.Duration
+	nextID   int
+	handlers map[int]JumpHandler
+}
+
+// NewMonotonicClock returns a MonotonicClock which reports wall clock jumps
+// larger than threshold.
+func NewMonotonicClock(threshold time.Duration) *MonotonicClock {
+	origin := time.Now()
+	return newMonotonicClock(threshold,
+		func() time.Time { return time.Now().Round(0) },
+		func() time.Duration { return time.Since(origin) })
+}
+
+func newMonotonicClock(threshold time.Duration, wall func() time.Time, mono func() time.Duration) *MonotonicClock {
+	return &MonotonicClock{
+		threshold: threshold,
+		start:     wall().Add(-mono()),
+		wall:      wall,
+		mono:      mono,
+		handlers:  make(map[int]JumpHandler),
+	}
+}
+
+// OnJump registers h to be called for every wall clock jump detected from now
+// on, until the returned func is called. Handlers are called by the goroutine
+// whose call to Now or Since detected the jump, after the clock has released
+// its lock.
+func (c *MonotonicClock) OnJump(h JumpHandler) (remove func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	c.handlers[id] = h
+
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.handlers, id)
+	}
+}
+
+// Now returns the wall time at which c was created plus the monotonic time
+// elapsed since.
+func (c *MonotonicClock) Now() time.Time {
+	elapsed := c.mono()
+	now := c.start.Add(elapsed)
+	c.check(c.wall().Sub(now))
+	return now
+}
+
+// Since returns the monotonic time elapsed since ts, which must have been
+// returned by c.Now to be immune to wall clock jumps.
+func (c *MonotonicClock) Since(ts time.Time) time.Duration {
+	return c.Now().Sub(ts)
+}
+
+// Wall returns the current wall clock time, as the system reports it.
+func (c *MonotonicClock) Wall() time.Time {
+	return c.wall()
+}
+
+// check compares offset, the current drift of the wall clock, with the drift
+// seen by the last check and calls the handlers if it changed by more than
+// the threshold. The drift is remembered on every check, so that slow drift
+// never adds up to a jump.
+func (c *MonotonicClock) check(offset time.Duration) {
+	c.mu.Lock()
+	jump := offset - c.offset
+	c.offset = offset
+	if jump <= c.threshold && jump >= -c.threshold {
+		c.mu.Unlock()
+		return
+	}
+	handlers := make([]JumpHandler, 0, len(c.handlers))
+	for _, h := range c.handlers {
+		handlers = append(handlers, h)
+	}
+	c.mu.Unlock()
+
+	for _, h := range handlers {
+		h(jump)
+	}
+}
+
+// After is the same as time.After(d), which waits for monotonic time.
+func (*MonotonicClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// NewTimer returns a new Timer.
+func (*MonotonicClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{
+		timer: time.NewTimer(d),
+	}
+}
+
+// NewTicker returns a new Ticker.
+func (*MonotonicClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{
+		ticker: time.NewTicker(d),
+	}
+}
+
+// AfterFunc is the same as time.AfterFunc(d, f).
+func (*MonotonicClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &realTimer{
+		timer: time.AfterFunc(d, f),
+	}
+}
+
+// Sleep pauses the MonotonicClock for duration d.
+func (*MonotonicClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
@@ -0,0 +1,95 @@
+package clock
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeSources is a wall clock and a monotonic clock which tests move apart.
+type fakeSources struct {
+	wall time.Time
+	mono time.Duration
+}
+
+func (s *fakeSources) step(d time.Duration) {
+	s.wall = s.wall.Add(d)
+	s.mono += d
+}
+
+func TestMonotonicClockJumps(t *testing.T) {
+	src := &fakeSources{wall: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := newMonotonicClock(time.Second,
+		func() time.Time { return src.wall },
+		func() time.Duration { return src.mono })
+
+	var jumps []time.Duration
+	remove := c.OnJump(func(jump time.Duration) { jumps = append(jumps, jump) })
+
+	start := c.Now()
+	src.step(time.Minute)
+	if got := c.Since(start); got != time.Minute {
+		t.Errorf("unexpected elapsed time: got=%v, want=%v", got, time.Minute)
+	}
+
+	// NTP steps the wall clock back an hour, the clock keeps going.
+	src.wall = src.wall.Add(-time.Hour)
+	src.step(time.Second)
+	if got := c.Since(start); got != time.Minute+time.Second {
+		t.Errorf("unexpected elapsed time: got=%v, want=%v", got, time.Minute+time.Second)
+	}
+	if got := c.Wall(); !got.Equal(src.wall) {
+		t.Errorf("unexpected wall time: got=%v, want=%v", got, src.wall)
+	}
+
+	// Slewing below the threshold is not a jump, and a jump is reported
+	// once.
+	src.wall = src.wall.Add(500 * time.Millisecond)
+	c.Now()
+	c.Now()
+	src.wall = src.wall.Add(2 * time.Second)
+	c.Now()
+
+	if want := []time.Duration{-time.Hour, 2 * time.Second}; !reflect.DeepEqual(jumps, want) {
+		t.Errorf("unexpected jumps: got=%v, want=%v", jumps, want)
+	}
+
+	remove()
+	src.wall = src.wall.Add(time.Hour)
+	c.Now()
+	if len(jumps) != 2 {
+		t.Errorf("unexpected call of a removed handler")
+	}
+}
+
+func TestMonotonicClockSlew(t *testing.T) {
+	src := &fakeSources{wall: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := newMonotonicClock(time.Second,
+		func() time.Time { return src.wall },
+		func() time.Duration { return src.mono })
+
+	jumps := 0
+	c.OnJump(func(time.Duration) { jumps++ })
+
+	// NTP slews the wall clock by 30ms a minute, 3s over 100 minutes.
+	for i := 0; i < 100; i++ {
+		src.step(time.Minute)
+		src.wall = src.wall.Add(30 * time.Millisecond)
+		c.Now()
+	}
+	if jumps != 0 {
+		t.Errorf("unexpected jumps for slow drift: %d", jumps)
+	}
+}
+
+func TestMonotonicClockReal(t *testing.T) {
+	c := NewMonotonicClock(time.Second)
+	start := c.Now()
+	if d := start.Sub(time.Now()); d > time.Second || d < -time.Second {
+		t.Errorf("expected the clock to start at the wall time, off by %v", d)
+	}
+	<-c.After(time.Millisecond)
+	if c.Since(start) < time.Millisecond {
+		t.Errorf("expected time to pass")
+	}
+}
@@ -0,0 +1,194 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// ScaledClock implements Clock with time which runs factor times as fast as
+// real time, from a chosen start time. Timers, tickers, After and Sleep wait
+// for the scaled durations, so a scenario spanning a day of clock time runs
+// in 24 minutes at a factor of 60, against real goroutines and without
+// stepping a FakeClock.
+type ScaledClock struct {
+	start  time.Time
+	origin time.Time
+	factor float64
+}
+
+// NewScaledClock returns a ScaledClock which reads start now and runs factor
+// times as fast as real time. It panics if factor is not positive.
+func NewScaledClock(start time.Time, factor float64) *ScaledClock {
+	if factor <= 0 {
+		panic("non-positive factor for NewScaledClock")
+	}
+	return &ScaledClock{
+		start:  start,
+		origin: time.Now(),
+		factor: factor,
+	}
+}
+
+// Now returns the start time plus the scaled time elapsed since c was created.
+func (c *ScaledClock) Now() time.Time {
+	return c.start.Add(time.Duration(float64(time.Since(c.origin)) * c.factor))
+}
+
+// Since returns the scaled time elapsed since ts.
+func (c *ScaledClock) Since(ts time.Time) time.Duration {
+	return c.Now().Sub(ts)
+}
+
+// realDuration returns the real duration of the scaled duration d.
+func (c *ScaledClock) realDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(float64(d) / c.factor)
+}
+
+// After is the scaled version of time.After(d). The channel receives the
+// time of c.
+func (c *ScaledClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer is the scaled version of time.NewTimer(d). The channel of the
+// Timer receives the time of c.
+func (c *ScaledClock) NewTimer(d time.Duration) Timer {
+	ch := make(chan time.Time, 1) // Don't block!
+	t := &scaledTimer{clock: c, c: ch}
+	t.timer = time.AfterFunc(c.realDuration(d), func() {
+		select {
+		case ch <- c.Now():
+		default:
+		}
+	})
+	return t
+}
+
+// AfterFunc is the scaled version of time.AfterFunc(d, f). The channel of the
+// returned Timer is nil.
+func (c *ScaledClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &scaledTimer{
+		clock: c,
+		timer: time.AfterFunc(c.realDuration(d), f),
+	}
+}
+
+// NewTicker is the scaled version of time.NewTicker(d). The channel of the
+// Ticker receives the time of c.
+func (c *ScaledClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	t := &scaledTicker{
+		clock: c,
+		c:     make(chan time.Time, 1), // hold one tick
+	}
+	// Hold the lock so that a first tick due right away sees the timer.
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.start(d)
+	t.timer = time.AfterFunc(t.period, t.tick)
+	return t
+}
+
+// Sleep pauses the caller for the scaled duration d.
+func (c *ScaledClock) Sleep(d time.Duration) {
+	time.Sleep(c.realDuration(d))
+}
+
+// scaledTimer implements Timer based on a ScaledClock.
+type scaledTimer struct {
+	clock *ScaledClock
+	timer *time.Timer
+	c     chan time.Time
+}
+
+// C returns the channel of the timer, it is nil for a timer created by
+// AfterFunc.
+func (t *scaledTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop calls Stop() on the underlying timer.
+func (t *scaledTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// Reset calls Reset() on the underlying timer with the real duration of d.
+func (t *scaledTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(t.clock.realDuration(d))
+}
+
+// scaledTicker implements Ticker based on a ScaledClock. It rearms a timer
+// after every tick, so that its period can be scaled.
+type scaledTicker struct {
+	clock *ScaledClock
+	c     chan time.Time
+
+	// mu protects the below fields
+	mu    sync.Mutex
+	timer *time.Timer
+	// period is the real period of the ticker, at least a nanosecond so that
+	// a large factor does not make the ticker spin.
+	period time.Duration
+	// next is the real time at which the next tick is due. Ticks are
+	// scheduled from it rather than from the time a tick was handled, so
+	// that the latency of handling ticks does not add up.
+	next    time.Time
+	stopped bool
+}
+
+// start sets the period of the ticker to the scaled duration d, with the
+// next tick due one period from now.
+func (t *scaledTicker) start(d time.Duration) {
+	t.period = t.clock.realDuration(d)
+	if t.period < time.Nanosecond {
+		t.period = time.Nanosecond
+	}
+	t.next = time.Now().Add(t.period)
+}
+
+func (t *scaledTicker) tick() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+	select {
+	case t.c <- t.clock.Now():
+	default:
+	}
+	// Drop the ticks which are already overdue, like time.Ticker does.
+	now := time.Now()
+	t.next = t.next.Add(t.period)
+	if !t.next.After(now) {
+		t.next = t.next.Add((now.Sub(t.next)/t.period + 1) * t.period)
+	}
+	t.timer.Reset(t.next.Sub(now))
+}
+
+func (t *scaledTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *scaledTicker) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = true
+	t.timer.Stop()
+}
+
+func (t *scaledTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stopped = false
+	t.start(d)
+	t.timer.Stop()
+	t.timer.Reset(t.period)
+}
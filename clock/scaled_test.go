@@ -0,0 +1,97 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScaledClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewScaledClock(start, 3600)
+
+	if d := c.Since(start); d < 0 || d > time.Hour {
+		t.Errorf("expected the clock to start at the start time, got %v", d)
+	}
+
+	// An hour of clock time is a second of real time.
+	realStart := time.Now()
+	at := <-c.After(time.Hour)
+	if elapsed := time.Since(realStart); elapsed < 900*time.Millisecond {
+		t.Errorf("expected to wait about a second, waited %v", elapsed)
+	}
+	if at.Before(start.Add(time.Hour)) {
+		t.Errorf("expected the channel to receive the clock time, got %v", at)
+	}
+
+	before := c.Now()
+	c.Sleep(30 * time.Minute)
+	if d := c.Since(before); d < 30*time.Minute {
+		t.Errorf("expected to sleep 30m of clock time, slept %v", d)
+	}
+}
+
+func TestScaledTimerTicker(t *testing.T) {
+	c := NewScaledClock(time.Now(), 1000)
+
+	timer := c.NewTimer(time.Hour)
+	if !timer.Stop() {
+		t.Errorf("expected Stop to stop a pending timer")
+	}
+	timer.Reset(time.Second)
+	select {
+	case <-timer.C():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the reset timer to fire")
+	}
+
+	fired := make(chan struct{})
+	c.AfterFunc(time.Second, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected AfterFunc to run")
+	}
+
+	ticker := c.NewTicker(time.Hour)
+	// Ticks are due at fixed points from the reset, never before them.
+	start := c.Now()
+	ticker.Reset(5 * time.Second)
+	for i := 1; i <= 3; i++ {
+		select {
+		case tick := <-ticker.C():
+			if due := start.Add(time.Duration(i) * 5 * time.Second); tick.Before(due) {
+				t.Errorf("tick %d came %v early", i, due.Sub(tick))
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected a tick")
+		}
+	}
+	ticker.Stop()
+	select {
+	case <-ticker.C():
+	default:
+	}
+	select {
+	case <-ticker.C():
+		t.Errorf("unexpected tick of a stopped ticker")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestScaledTickerShortPeriod(t *testing.T) {
+	// The real period of the ticker rounds down to zero.
+	c := NewScaledClock(time.Now(), 1e12)
+	ticker := c.NewTicker(time.Nanosecond)
+	defer ticker.Stop()
+
+	if period := ticker.(*scaledTicker).period; period < time.Nanosecond {
+		t.Errorf("expected a real period of at least 1ns, got %v", period)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ticker.C():
+		case <-time.After(10 * time.Second):
+			t.Fatalf("expected a tick")
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package clock
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSimulationTimeout is returned by Simulation.Run when the virtual
+	// deadline passes before the condition holds.
+	ErrSimulationTimeout = errors.New("simulation timed out waiting for the condition")
+	// ErrSimulationStalled is returned by Simulation.Run when nothing is
+	// waiting on the clock but the condition does not hold.
+	ErrSimulationStalled = errors.New("simulation stalled without pending timers")
+)
+
+// defaultSettleTime is the real time a Simulation waits for its goroutines to
+// block on the clock again after an event.
+const defaultSettleTime = 5 * time.Millisecond
+
+// TraceEvent records a timer, ticker or After channel of a Simulation firing.
+type TraceEvent struct {
+	// Time is the virtual time at which the waiter fired.
+	Time time.Time
+	// Kind is the method which created the waiter: "After", "Timer",
+	// "Ticker" or "AfterFunc".
+	Kind string
+	// Caller is the name of the function which armed the waiter.
+	Caller string
+}
+
+// Simulation runs goroutines against a FakeClock in virtual time. Instead of
+// stepping the clock by hand, a test starts the component under test with Go
+// and calls Run, which moves the clock from one pending timer to the next,
+// letting the goroutines react to every event, until a condition holds. Every
+// event is recorded in a trace.
+//
+// The goroutines must only wait on the clock of the simulation. Virtual time
+// is deterministic, but the goroutines run in real time, so a Simulation has
+// to tell when they are blocked on the clock again after an event. By default
+// it considers them blocked once they have not armed or stopped a timer for
+// the settle time. This costs the settle time of real time per event, and a
+// goroutine which takes longer than that to re-arm its timer, on a loaded
+// machine or doing slow real work, misses its event. Components with a known
+// number of timers should use SetExpectedWaiters instead, which waits for the
+// timers to be armed rather than for time to pass.
+type Simulation struct {
+	clock      *FakeClock
+	settleTime time.Duration
+	// expectedWaiters is the number of waiters settle waits for, 0 if it
+	// waits for the settle time instead.
+	expectedWaiters int
+	wg              sync.WaitGroup
+
+	// mu protects the below fields
+	mu      sync.Mutex
+	running int
+	trace   []TraceEvent
+}
+
+// NewSimulation returns a Simulation whose clock starts at start.
+func NewSimulation(start time.Time) *Simulation {
+	s := &Simulation{
+		clock:      NewFakeClock(start),
+		settleTime: defaultSettleTime,
+	}
+	s.clock.onFire = s.record
+	return s
+}
+
+// Clock returns the clock of the simulation, which the goroutines under test
+// must use.
+func (s *Simulation) Clock() *FakeClock {
+	return s.clock
+}
+
+// SetSettleTime sets the real time the simulation waits for its goroutines
+// to block on the clock again after an event. It defaults to 5ms.
+func (s *Simulation) SetSettleTime(d time.Duration) {
+	s.settleTime = d
+}
+
+// SetExpectedWaiters makes Run wait, after every event, until at least n
+// timers, tickers, After channels or AfterFuncs are registered on the clock,
+// or until every goroutine started with Go has returned, instead of waiting
+// for the settle time. n is usually the number of goroutines under test, each
+// blocked on one timer between events. If the goroutines register fewer
+// waiters while some of them keep running, Run blocks. n <= 0 restores the
+// settle time.
+func (s *Simulation) SetExpectedWaiters(n int) {
+	s.expectedWaiters = n
+}
+
+// Go runs f in a new goroutine of the simulation.
+func (s *Simulation) Go(f func()) {
+	s.mu.Lock()
+	s.running++
+	s.mu.Unlock()
+	s.wg.Add(1)
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.running--
+			s.mu.Unlock()
+			s.wakeSettle()
+			s.wg.Done()
+		}()
+		f()
+	}()
+}
+
+// Wait blocks until every goroutine started with Go has returned.
+func (s *Simulation) Wait() {
+	s.wg.Wait()
+}
+
+// Run advances the clock event by event until condition returns true, and
+// returns nil. A nil condition holds once every goroutine started with Go has
+// returned. Run returns ErrSimulationTimeout if the condition still does not
+// hold timeout of virtual time after Run was called, and ErrSimulationStalled
+// if it does not hold while nothing waits on the clock.
+func (s *Simulation) Run(condition func() bool, timeout time.Duration) error {
+	if condition == nil {
+		condition = s.done
+	}
+	deadline := s.clock.Now().Add(timeout)
+	for {
+		s.settle()
+		if condition() {
+			return nil
+		}
+
+		next, ok := s.nextEvent()
+		switch {
+		case !ok && s.clock.Now().Before(deadline):
+			return ErrSimulationStalled
+		case !ok || next.After(deadline):
+			if !s.clock.Now().Before(deadline) {
+				return ErrSimulationTimeout
+			}
+			s.clock.SetTime(deadline)
+		default:
+			// A waiter reset with a non-positive duration is due in the
+			// past, the clock must not go back for it.
+			if now := s.clock.Now(); next.Before(now) {
+				next = now
+			}
+			s.clock.SetTime(next)
+		}
+	}
+}
+
+// Trace returns the events recorded so far, in the order they fired.
+func (s *Simulation) Trace() []TraceEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]TraceEvent(nil), s.trace...)
+}
+
+// record is the onFire hook of the clock, it is called under the lock of the
+// clock.
+func (s *Simulation) record(w *fakeClockWaiter, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trace = append(s.trace, TraceEvent{Time: t, Kind: w.kind, Caller: w.caller})
+}
+
+func (s *Simulation) done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running == 0
+}
+
+// settle waits until the goroutines are blocked on the clock again. It waits
+// for the expected number of waiters if it is set, and otherwise until the
+// waiters of the clock have not changed for the settle time.
+func (s *Simulation) settle() {
+	if s.expectedWaiters > 0 {
+		s.waitForWaiters(s.expectedWaiters)
+		return
+	}
+	version := s.clockVersion()
+	for {
+		time.Sleep(s.settleTime)
+		v := s.clockVersion()
+		if v == version {
+			return
+		}
+		version = v
+	}
+}
+
+// waitForWaiters blocks until at least n waiters are registered on the clock
+// or every goroutine has returned.
+func (s *Simulation) waitForWaiters(n int) {
+	f := s.clock
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.waitersChanged == nil {
+		f.waitersChanged = sync.NewCond(&f.lock)
+	}
+	for len(f.waiters) < n && !s.done() {
+		f.waitersChanged.Wait()
+	}
+}
+
+// wakeSettle wakes up waitForWaiters when a goroutine has returned.
+func (s *Simulation) wakeSettle() {
+	s.clock.lock.Lock()
+	defer s.clock.lock.Unlock()
+	if s.clock.waitersChanged != nil {
+		s.clock.waitersChanged.Broadcast()
+	}
+}
+
+func (s *Simulation) clockVersion() uint64 {
+	s.clock.lock.RLock()
+	defer s.clock.lock.RUnlock()
+	return s.clock.version
+}
+
+// nextEvent returns the time of the earliest waiter of the clock.
+func (s *Simulation) nextEvent() (time.Time, bool) {
+	s.clock.lock.RLock()
+	defer s.clock.lock.RUnlock()
+	if len(s.clock.waiters) == 0 {
+		return time.Time{}, false
+	}
+	next := s.clock.waiters[0].targetTime
+	for _, w := range s.clock.waiters[1:] {
+		if w.targetTime.Before(next) {
+			next = w.targetTime
+		}
+	}
+	return next, true
+}
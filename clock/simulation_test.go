@@ -0,0 +1,148 @@
+package clock
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retry calls attempt with doubling delays until it succeeds.
+func retry(c Clock, attempt func() bool) {
+	delay := time.Second
+	for !attempt() {
+		t := c.NewTimer(delay)
+		<-t.C()
+		delay *= 2
+	}
+}
+
+func TestSimulation(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sim := NewSimulation(start)
+	c := sim.Clock()
+
+	var attempts int32
+	sim.Go(func() {
+		retry(c, func() bool {
+			return atomic.AddInt32(&attempts, 1) == 4
+		})
+	})
+	var cleanups int32
+	stopCh := make(chan struct{})
+	sim.Go(func() {
+		ticker := c.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				atomic.AddInt32(&cleanups, 1)
+			case <-stopCh:
+				return
+			}
+		}
+	})
+
+	err := sim.Run(func() bool { return atomic.LoadInt32(&attempts) == 4 }, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The retries waited 1s, 2s and 4s.
+	if got := c.Since(start); got != 7*time.Second {
+		t.Errorf("unexpected virtual time: got=%v, want=%v", got, 7*time.Second)
+	}
+
+	want := []struct {
+		at   time.Duration
+		kind string
+	}{
+		{time.Second, "Timer"},
+		{3 * time.Second, "Timer"},
+		{5 * time.Second, "Ticker"},
+		{7 * time.Second, "Timer"},
+	}
+	trace := sim.Trace()
+	if len(trace) != len(want) {
+		t.Fatalf("unexpected trace: %+v", trace)
+	}
+	for i, w := range want {
+		if got := trace[i]; !got.Time.Equal(start.Add(w.at)) || got.Kind != w.kind {
+			t.Errorf("unexpected event %d: got=%+v, want %s at %v", i, got, w.kind, w.at)
+		}
+	}
+	if !strings.HasSuffix(trace[0].Caller, ".retry") {
+		t.Errorf("unexpected caller: %s", trace[0].Caller)
+	}
+
+	// Only the ticker is left, the simulation runs until the deadline.
+	if err := sim.Run(func() bool { return false }, 12*time.Second); err != ErrSimulationTimeout {
+		t.Errorf("expected ErrSimulationTimeout, got %v", err)
+	}
+	if got := atomic.LoadInt32(&cleanups); got != 3 {
+		t.Errorf("unexpected cleanups: got=%d, want=3", got)
+	}
+
+	close(stopCh)
+	if err := sim.Run(nil, time.Hour); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSimulationStalled(t *testing.T) {
+	sim := NewSimulation(time.Now())
+	block := make(chan struct{})
+	defer close(block)
+	sim.Go(func() { <-block })
+
+	if err := sim.Run(nil, time.Hour); err != ErrSimulationStalled {
+		t.Errorf("expected ErrSimulationStalled, got %v", err)
+	}
+}
+
+func TestSimulationExpectedWaiters(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sim := NewSimulation(start)
+	sim.SetExpectedWaiters(1)
+	c := sim.Clock()
+
+	var attempts int32
+	sim.Go(func() {
+		retry(c, func() bool {
+			// Real work slower than the settle time does not miss events.
+			time.Sleep(20 * time.Millisecond)
+			return atomic.AddInt32(&attempts, 1) == 4
+		})
+	})
+
+	if err := sim.Run(nil, time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 4 {
+		t.Errorf("unexpected attempts: got=%d, want=4", got)
+	}
+	if got := c.Since(start); got != 7*time.Second {
+		t.Errorf("unexpected virtual time: got=%v, want=%v", got, 7*time.Second)
+	}
+}
+
+func TestSimulationResetIntoThePast(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sim := NewSimulation(start)
+	sim.SetExpectedWaiters(1)
+	c := sim.Clock()
+
+	sim.Go(func() {
+		timer := c.NewTimer(time.Second)
+		<-timer.C()
+		timer.Reset(-time.Second)
+		<-timer.C()
+	})
+
+	if err := sim.Run(nil, time.Hour); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The clock never goes back.
+	if got := c.Since(start); got != time.Second {
+		t.Errorf("unexpected virtual time: got=%v, want=%v", got, time.Second)
+	}
+}
@@ -1,12 +1,19 @@
 module github.com/x893675/gopkg
 
-go 1.15
+go 1.20
 
 require (
 	github.com/google/uuid v1.2.0
-	github.com/hashicorp/golang-lru v0.5.4
 	github.com/stretchr/testify v1.4.0
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20190510104115-cbcb75029529
 	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2 // indirect
+)
@@ -0,0 +1,268 @@
+/*
+Copyright (C) 2012 Rob Figueiredo
+All Rights Reserved.
+
+MIT LICENSE
+
+Permission is hereby granted, free of charge, to any person obtaining a copy of
+this software and associated documentation files (the "Software"), to deal in
+the Software without restriction, including without limitation the rights to
+use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+the Software, and to permit persons to whom the Software is furnished to do so,
+subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+*/
+
+// The parser is derived from parser.go of github.com/robfig/cron/v3.
+
+package schedule
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bounds are the valid values of a field of a cron expression.
+type bounds struct {
+	min, max uint
+	// names maps the lower case names of the values, if they have any.
+	names map[string]uint
+}
+
+var (
+	seconds = bounds{0, 59, nil}
+	minutes = bounds{0, 59, nil}
+	hours   = bounds{0, 23, nil}
+	dom     = bounds{1, 31, nil}
+	months  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// dow accepts 7 as well as 0 for Sunday.
+	dow = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// starBit is set in a field which was given as * or ?. It tells the day of
+// month and day of week fields apart from ones restricted to every day.
+const starBit = 1 << 63
+
+// descriptors are the predefined schedules, as 6-field expressions.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// Parse parses a cron expression in the local time zone, see
+// ParseInLocation.
+func Parse(spec string) (Schedule, error) {
+	return ParseInLocation(spec, time.Local)
+}
+
+// MustParse is like Parse but panics if spec cannot be parsed. It simplifies
+// the initialization of global schedules.
+func MustParse(spec string) Schedule {
+	s, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ParseInLocation parses a cron expression whose times are in loc. It
+// accepts:
+//
+//   - standard 5-field expressions: minute, hour, day of month, month and
+//     day of week;
+//   - 6-field expressions with a leading seconds field;
+//   - the descriptors @yearly (or @annually), @monthly, @weekly, @daily (or
+//     @midnight) and @hourly;
+//   - "@every <duration>", which runs at a fixed interval, see Interval.
+//
+// A field is a comma separated list of values, ranges such as "1-5", and
+// steps such as "*/15" or "10-50/20". Months and days of week may be given by
+// their three letter English names. When both the day of month and the day of
+// week are restricted, a day matching either runs, as in standard cron. The
+// expression may start with "CRON_TZ=<zone>" or "TZ=<zone>" to override loc.
+func ParseInLocation(spec string, loc *time.Location) (Schedule, error) {
+	if loc == nil {
+		return nil, fmt.Errorf("schedule: nil location")
+	}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("schedule: empty spec")
+	}
+
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("schedule: missing fields after time zone in %q", spec)
+		}
+		name := spec[strings.Index(spec, "=")+1 : i]
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("schedule: bad time zone %q: %v", name, err)
+		}
+		loc = l
+		spec = strings.TrimSpace(spec[i:])
+	}
+
+	if strings.HasPrefix(spec, "@") {
+		return parseDescriptor(spec, loc)
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("schedule: expected 5 or 6 fields, found %d in %q", len(fields), spec)
+	}
+
+	s := &cronSchedule{loc: loc}
+	for _, f := range []struct {
+		bits   *uint64
+		bounds bounds
+	}{
+		{&s.second, seconds},
+		{&s.minute, minutes},
+		{&s.hour, hours},
+		{&s.dom, dom},
+		{&s.month, months},
+		{&s.dow, dow},
+	} {
+		bits, err := parseField(fields[0], f.bounds)
+		if err != nil {
+			return nil, err
+		}
+		*f.bits = bits
+		fields = fields[1:]
+	}
+	// Sunday is both 0 and 7.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+func parseDescriptor(spec string, loc *time.Location) (Schedule, error) {
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("schedule: bad duration in %q: %v", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("schedule: non-positive duration in %q", spec)
+		}
+		return Interval(d), nil
+	}
+	expr, ok := descriptors[spec]
+	if !ok {
+		return nil, fmt.Errorf("schedule: unknown descriptor %q", spec)
+	}
+	return ParseInLocation(expr, loc)
+}
+
+// parseField returns the bits of the values matched by a comma separated list
+// of ranges.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, expr := range strings.Split(field, ",") {
+		r, err := parseRange(expr, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= r
+	}
+	return bits, nil
+}
+
+// parseRange returns the bits of the values matched by a single value, range
+// or step expression.
+func parseRange(expr string, b bounds) (uint64, error) {
+	rangeAndStep := strings.Split(expr, "/")
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	if len(rangeAndStep) > 2 || len(lowAndHigh) > 2 {
+		return 0, fmt.Errorf("schedule: bad range %q", expr)
+	}
+
+	var start, end, step uint = 0, 0, 1
+	var extra uint64
+	var err error
+	if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("schedule: bad range %q", expr)
+		}
+		start, end = b.min, b.max
+		extra = starBit
+	} else {
+		if start, err = parseValue(lowAndHigh[0], b); err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			if end, err = parseValue(lowAndHigh[1], b); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if len(rangeAndStep) == 2 {
+		if step, err = parseUint(rangeAndStep[1]); err != nil {
+			return 0, err
+		}
+		if step == 0 {
+			return 0, fmt.Errorf("schedule: step of zero in %q", expr)
+		}
+		// A step makes "*" a restriction, and "N/step" a range to the
+		// maximum.
+		extra = 0
+		if len(lowAndHigh) == 1 && start == end && lowAndHigh[0] != "*" && lowAndHigh[0] != "?" {
+			end = b.max
+		}
+	}
+
+	if start < b.min || end > b.max || start > end {
+		return 0, fmt.Errorf("schedule: %q is out of range [%d, %d]", expr, b.min, b.max)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << i
+	}
+	return bits | extra, nil
+}
+
+func parseValue(s string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	return parseUint(s)
+}
+
+func parseUint(s string) (uint, error) {
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || v > math.MaxUint8 {
+		return 0, fmt.Errorf("schedule: bad number %q", s)
+	}
+	return uint(v), nil
+}
@@ -0,0 +1,155 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNext(t *testing.T) {
+	testCases := []struct {
+		spec string
+		from string
+		want string
+	}{
+		// Simple cases.
+		{"* * * * *", "2020-07-09T14:45:10Z", "2020-07-09T14:46:00Z"},
+		{"* * * * * *", "2020-07-09T14:45:10.5Z", "2020-07-09T14:45:11Z"},
+		{"*/15 * * * *", "2020-07-09T14:45:00Z", "2020-07-09T15:00:00Z"},
+		{"30 9 * * *", "2020-07-09T14:45:00Z", "2020-07-10T09:30:00Z"},
+		{"0 10-50/20 * * * *", "2020-07-09T14:45:00Z", "2020-07-09T14:50:00Z"},
+		{"5/20 * * * *", "2020-07-09T14:45:00Z", "2020-07-09T15:05:00Z"},
+		{"0,30 * * * *", "2020-07-09T14:15:00Z", "2020-07-09T14:30:00Z"},
+
+		// Wrapping around months and years.
+		{"0 0 1 * *", "2020-07-09T14:45:00Z", "2020-08-01T00:00:00Z"},
+		{"0 0 1 jan *", "2020-07-09T14:45:00Z", "2021-01-01T00:00:00Z"},
+		{"0 0 29 2 *", "2021-03-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"0 0 31 * *", "2020-04-01T00:00:00Z", "2020-05-31T00:00:00Z"},
+
+		// Days of week, alone and with days of month.
+		{"0 9 * * mon-fri", "2020-07-10T10:00:00Z", "2020-07-13T09:00:00Z"},
+		{"0 0 * * 7", "2020-07-09T00:00:00Z", "2020-07-12T00:00:00Z"},
+		{"0 0 * * SUN", "2020-07-09T00:00:00Z", "2020-07-12T00:00:00Z"},
+		{"0 0 ? * 0", "2020-07-09T00:00:00Z", "2020-07-12T00:00:00Z"},
+		{"0 0 15 * fri", "2020-07-09T00:00:00Z", "2020-07-10T00:00:00Z"},
+		{"0 0 10 * mon", "2020-07-09T00:00:00Z", "2020-07-10T00:00:00Z"},
+		{"0 0 1 * */2", "2020-07-09T00:00:00Z", "2020-07-11T00:00:00Z"},
+
+		// Descriptors.
+		{"@hourly", "2020-07-09T14:45:00Z", "2020-07-09T15:00:00Z"},
+		{"@daily", "2020-07-09T14:45:00Z", "2020-07-10T00:00:00Z"},
+		{"@midnight", "2020-07-09T14:45:00Z", "2020-07-10T00:00:00Z"},
+		{"@weekly", "2020-07-09T14:45:00Z", "2020-07-12T00:00:00Z"},
+		{"@monthly", "2020-07-09T14:45:00Z", "2020-08-01T00:00:00Z"},
+		{"@yearly", "2020-07-09T14:45:00Z", "2021-01-01T00:00:00Z"},
+		{"@annually", "2020-07-09T14:45:00Z", "2021-01-01T00:00:00Z"},
+		{"@every 90s", "2020-07-09T14:45:00Z", "2020-07-09T14:46:30Z"},
+
+		// Time zones.
+		{"TZ=Asia/Shanghai 0 9 * * *", "2020-07-09T00:00:00Z", "2020-07-09T01:00:00Z"},
+		{"CRON_TZ=America/New_York 0 9 * * *", "2020-07-09T00:00:00Z", "2020-07-09T13:00:00Z"},
+
+		// Impossible dates.
+		{"0 0 30 2 *", "2020-07-09T00:00:00Z", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			s, err := ParseInLocation(tc.spec, time.UTC)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := s.Next(mustTime(t, tc.from))
+			if tc.want == "" {
+				if !got.IsZero() {
+					t.Errorf("expected the zero time, got %v", got)
+				}
+				return
+			}
+			if want := mustTime(t, tc.want); !got.Equal(want) {
+				t.Errorf("unexpected next time: got=%v, want=%v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database not available: %v", err)
+	}
+
+	testCases := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		// 02:30 does not exist on 2020-03-08, the job runs the next day.
+		{"30 2 * * *", time.Date(2020, 3, 7, 3, 0, 0, 0, loc), time.Date(2020, 3, 9, 2, 30, 0, 0, loc)},
+		// Hourly jobs skip the missing hour.
+		{"0 * * * *", time.Date(2020, 3, 8, 1, 30, 0, 0, loc), time.Date(2020, 3, 8, 3, 0, 0, 0, loc)},
+		// Midnight exists on both days.
+		{"0 0 * * *", time.Date(2020, 11, 1, 0, 30, 0, 0, loc), time.Date(2020, 11, 2, 0, 0, 0, 0, loc)},
+	}
+	for _, tc := range testCases {
+		s, err := ParseInLocation(tc.spec, loc)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := s.Next(tc.from); !got.Equal(tc.want) {
+			t.Errorf("%q from %v: got=%v, want=%v", tc.spec, tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*-5 * * * *",
+		"1-2-3 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"@often",
+		"@every",
+		"@every 1x",
+		"@every -1s",
+		"TZ=Nowhere/Land * * * * *",
+		"TZ=UTC",
+	} {
+		if _, err := ParseInLocation(spec, time.UTC); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestParseNilLocation(t *testing.T) {
+	if _, err := ParseInLocation("* * * * *", nil); err == nil {
+		t.Errorf("expected an error for a nil location")
+	}
+}
+
+func TestMustParse(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected MustParse to panic")
+		}
+	}()
+	MustParse("* * *")
+}
+
+func mustTime(t *testing.T, s string) time.Time {
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		t.Fatalf("bad time %q: %v", s, err)
+	}
+	return ts
+}
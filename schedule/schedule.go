@@ -0,0 +1,118 @@
+// Package schedule computes the activation times of cron expressions and
+// calendar intervals, and runs functions at them on a clock.Clock.
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+	"github.com/x893675/gopkg/runtime"
+)
+
+// Schedule describes the activation times of a job.
+type Schedule interface {
+	// Next returns the first activation time strictly after t, or the zero
+	// time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// Interval returns a Schedule which activates d after the time it is asked
+// about, without alignment to the calendar. Run by Until, the period is
+// measured from the end of one run to the start of the next.
+func Interval(d time.Duration) Schedule {
+	if d <= 0 {
+		panic("non-positive interval for Interval")
+	}
+	return interval(d)
+}
+
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Every returns a Schedule which activates at the multiples of d since
+// midnight in loc, such as 00:00, 00:15, 00:30 for 15 minutes. If d does not
+// divide a day, the last activation of a day is followed by the next
+// midnight. The multiples are counted in elapsed time, so on the day of a DST
+// change they move by the size of the change for intervals not dividing it.
+// Every panics if d is not positive or loc is nil.
+func Every(d time.Duration, loc *time.Location) Schedule {
+	if d <= 0 {
+		panic("non-positive interval for Every")
+	}
+	if loc == nil {
+		panic("nil location for Every")
+	}
+	return &calendarInterval{period: d, loc: loc}
+}
+
+type calendarInterval struct {
+	period time.Duration
+	loc    *time.Location
+}
+
+func (c *calendarInterval) Next(t time.Time) time.Time {
+	local := t.In(c.loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, c.loc)
+	next := midnight.Add((t.Sub(midnight)/c.period + 1) * c.period)
+
+	tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, c.loc)
+	if !next.Before(tomorrow) {
+		next = tomorrow
+	}
+	return next.In(t.Location())
+}
+
+// Until runs f at every activation time of s, as seen by c, until stopCh is
+// closed. Activations missed while f runs are skipped. Until returns when s
+// has no further activation.
+//
+// Until is meant to be run as a goroutine, and to be tested with a
+// clock.FakeClock stepped over the activation times.
+func Until(f func(), s Schedule, c clock.Clock, stopCh <-chan struct{}) {
+	var t clock.Timer
+	defer func() {
+		if t != nil {
+			t.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		now := c.Now()
+		next := s.Next(now)
+		if next.IsZero() {
+			return
+		}
+		if t == nil {
+			t = c.NewTimer(next.Sub(now))
+		} else {
+			t.Reset(next.Sub(now))
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-t.C():
+		}
+
+		func() {
+			defer runtime.HandleCrash()
+			f()
+		}()
+	}
+}
+
+// UntilWithContext runs f at every activation time of s, as seen by c, until
+// ctx is done. See Until.
+func UntilWithContext(ctx context.Context, f func(context.Context), s Schedule, c clock.Clock) {
+	Until(func() { f(ctx) }, s, c, ctx.Done())
+}
@@ -0,0 +1,137 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/x893675/gopkg/clock"
+)
+
+func TestEvery(t *testing.T) {
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	testCases := []struct {
+		period time.Duration
+		from   time.Time
+		want   time.Time
+	}{
+		{15 * time.Minute, time.Date(2020, 7, 9, 14, 7, 0, 0, loc), time.Date(2020, 7, 9, 14, 15, 0, 0, loc)},
+		{15 * time.Minute, time.Date(2020, 7, 9, 14, 15, 0, 0, loc), time.Date(2020, 7, 9, 14, 30, 0, 0, loc)},
+		{time.Hour, time.Date(2020, 7, 9, 23, 59, 59, 0, loc), time.Date(2020, 7, 10, 0, 0, 0, 0, loc)},
+		// 7h does not divide a day, 21:00 is followed by midnight.
+		{7 * time.Hour, time.Date(2020, 7, 9, 21, 0, 0, 0, loc), time.Date(2020, 7, 10, 0, 0, 0, 0, loc)},
+		{7 * time.Hour, time.Date(2020, 7, 10, 0, 0, 0, 0, loc), time.Date(2020, 7, 10, 7, 0, 0, 0, loc)},
+		// The multiples are counted in loc, not in the location of from.
+		{6 * time.Hour, time.Date(2020, 7, 9, 0, 30, 0, 0, time.UTC), time.Date(2020, 7, 9, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range testCases {
+		if got := Every(tc.period, loc).Next(tc.from); !got.Equal(tc.want) {
+			t.Errorf("Every(%v) from %v: got=%v, want=%v", tc.period, tc.from, got, tc.want)
+		}
+	}
+}
+
+func TestEveryNilLocation(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Every to panic")
+		}
+	}()
+	Every(time.Minute, nil)
+}
+
+func TestInterval(t *testing.T) {
+	from := time.Date(2020, 7, 9, 14, 7, 3, 0, time.UTC)
+	if got, want := Interval(time.Minute).Next(from), from.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("unexpected next time: got=%v, want=%v", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Interval to panic")
+		}
+	}()
+	Interval(0)
+}
+
+func TestUntil(t *testing.T) {
+	start := time.Date(2020, 7, 9, 14, 7, 0, 0, time.UTC)
+	fc := clock.NewFakeClock(start)
+	s := Every(15*time.Minute, time.UTC)
+
+	ran := make(chan time.Time)
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Until(func() { ran <- fc.Now() }, s, fc, stopCh)
+	}()
+
+	for _, want := range []time.Time{
+		time.Date(2020, 7, 9, 14, 15, 0, 0, time.UTC),
+		time.Date(2020, 7, 9, 14, 30, 0, 0, time.UTC),
+	} {
+		fc.BlockUntilWaiters(1)
+		fc.SetTime(want.Add(-time.Second))
+		select {
+		case got := <-ran:
+			t.Fatalf("ran early at %v", got)
+		case <-time.After(10 * time.Millisecond):
+		}
+		fc.SetTime(want)
+		if got := <-ran; !got.Equal(want) {
+			t.Errorf("unexpected run time: got=%v, want=%v", got, want)
+		}
+	}
+
+	// Activations missed while f runs are skipped.
+	fc.BlockUntilWaiters(1)
+	fc.SetTime(time.Date(2020, 7, 9, 15, 10, 0, 0, time.UTC))
+	<-ran
+	fc.BlockUntilWaiters(1)
+	fc.SetTime(time.Date(2020, 7, 9, 15, 15, 0, 0, time.UTC))
+	if got, want := <-ran, time.Date(2020, 7, 9, 15, 15, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("unexpected run time: got=%v, want=%v", got, want)
+	}
+
+	fc.BlockUntilWaiters(1)
+	close(stopCh)
+	<-done
+	if fc.HasWaiters() {
+		t.Errorf("expected the timer to be stopped")
+	}
+}
+
+func TestUntilNoActivation(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	s, err := ParseInLocation("0 0 30 2 *", time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Until returns right away as s never activates.
+	Until(func() { t.Errorf("unexpected run") }, s, fc, make(chan struct{}))
+}
+
+func TestUntilWithContext(t *testing.T) {
+	fc := clock.NewFakeClock(time.Date(2020, 7, 9, 14, 7, 0, 0, time.UTC))
+	s, err := ParseInLocation("*/5 * * * * *", time.UTC)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ran := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		UntilWithContext(ctx, func(context.Context) { ran <- struct{}{} }, s, fc)
+	}()
+
+	fc.BlockUntilWaiters(1)
+	fc.Step(5 * time.Second)
+	<-ran
+
+	fc.BlockUntilWaiters(1)
+	cancel()
+	<-done
+}
@@ -633,3 +633,75 @@ func ExponentialBackoffWithContext(ctx context.Context, backoff Backoff, conditi
 
 	return ErrWaitTimeout
 }
+
+// ConditionWithContextFunc returns the value it found and true if the
+// condition is satisfied, or an error if the loop should be aborted. The
+// context passed to the condition is the one the poll was started with, so the
+// condition can make cancellable calls.
+type ConditionWithContextFunc[T any] func(ctx context.Context) (value T, done bool, err error)
+
+// runContextConditionWithCrashProtection runs a ConditionWithContextFunc with
+// crash protection
+func runContextConditionWithCrashProtection[T any](ctx context.Context, condition ConditionWithContextFunc[T]) (T, bool, error) {
+	defer runtime.HandleCrash()
+	return condition(ctx)
+}
+
+// PollUntilContextCancel tries a condition func until it returns true, an
+// error, or ctx is done.
+//
+// If immediate is true, 'condition' is run before waiting for the interval,
+// otherwise the interval is waited before its first run. 'condition' is not
+// run once ctx is done.
+//
+// It returns the value of the call to 'condition' which returned true or an
+// error, and the error. If ctx is done first it returns the zero value and
+// ctx.Err().
+//
+// The interval is not jittered, every caller polls at exactly interval. Some
+// intervals may be missed if the condition takes too long.
+func PollUntilContextCancel[T any](ctx context.Context, interval time.Duration, immediate bool, condition ConditionWithContextFunc[T]) (T, error) {
+	return pollUntilContext(ctx, poller(interval, 0), immediate, condition)
+}
+
+// PollUntilContextTimeout is PollUntilContextCancel with ctx limited to
+// timeout. When the timeout is reached it returns context.DeadlineExceeded.
+func PollUntilContextTimeout[T any](ctx context.Context, interval, timeout time.Duration, immediate bool, condition ConditionWithContextFunc[T]) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return PollUntilContextCancel(ctx, interval, immediate, condition)
+}
+
+func pollUntilContext[T any](ctx context.Context, wait WaitFunc, immediate bool, condition ConditionWithContextFunc[T]) (T, error) {
+	var zero T
+	if immediate {
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+		if v, ok, err := runContextConditionWithCrashProtection(ctx, condition); err != nil || ok {
+			return v, err
+		}
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	c := wait(stopCh)
+	for {
+		select {
+		case _, open := <-c:
+			// The tick may have raced with ctx, don't run the condition
+			// once ctx is done.
+			if err := ctx.Err(); err != nil {
+				return zero, err
+			}
+			if v, ok, err := runContextConditionWithCrashProtection(ctx, condition); err != nil || ok {
+				return v, err
+			}
+			if !open {
+				return zero, ErrWaitTimeout
+			}
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	}
+}
@@ -70,6 +70,26 @@ func TestUntilWithContext(t *testing.T) {
 	<-called
 }
 
+func TestUntilWithFakeClockDeadline(t *testing.T) {
+	fc := clock.NewFakeClock(time.Now())
+	ctx, cancel := clock.WithTimeout(context.TODO(), fc, time.Minute)
+	defer cancel()
+
+	called := make(chan struct{})
+	go func() {
+		<-called
+		fc.Step(time.Minute)
+	}()
+	var once sync.Once
+	UntilWithContext(ctx, func(context.Context) {
+		once.Do(func() { close(called) })
+	}, time.Millisecond)
+
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", ctx.Err())
+	}
+}
+
 func TestNonSlidingUntil(t *testing.T) {
 	ch := make(chan struct{})
 	close(ch)
@@ -873,3 +893,128 @@ func TestExponentialBackoffWithContext(t *testing.T) {
 		})
 	}
 }
+
+func TestPollUntilContextCancel(t *testing.T) {
+	errPoll := errors.New("poll failed")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name             string
+		ctx              context.Context
+		immediate        bool
+		callback         func(attempts int) (string, bool, error)
+		valueExpected    string
+		attemptsExpected int
+		errExpected      error
+	}{
+		{
+			name:      "condition returns a value immediately",
+			ctx:       context.Background(),
+			immediate: true,
+			callback: func(attempts int) (string, bool, error) {
+				return "found", true, nil
+			},
+			valueExpected:    "found",
+			attemptsExpected: 1,
+		},
+		{
+			name: "condition returns a value after several polls",
+			ctx:  context.Background(),
+			callback: func(attempts int) (string, bool, error) {
+				return fmt.Sprintf("attempt %d", attempts), attempts == 3, nil
+			},
+			valueExpected:    "attempt 3",
+			attemptsExpected: 3,
+		},
+		{
+			name:      "condition returns an error",
+			ctx:       context.Background(),
+			immediate: true,
+			callback: func(attempts int) (string, bool, error) {
+				return "partial", false, errPoll
+			},
+			valueExpected:    "partial",
+			attemptsExpected: 1,
+			errExpected:      errPoll,
+		},
+		{
+			name:      "context already canceled",
+			ctx:       canceled,
+			immediate: true,
+			callback: func(attempts int) (string, bool, error) {
+				return "found", true, nil
+			},
+			attemptsExpected: 0,
+			errExpected:      context.Canceled,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			value, err := PollUntilContextCancel(test.ctx, time.Millisecond, test.immediate, func(ctx context.Context) (string, bool, error) {
+				if ctx != test.ctx {
+					t.Errorf("expected the context of the poll to be passed to the condition")
+				}
+				attempts++
+				return test.callback(attempts)
+			})
+
+			if test.errExpected != err {
+				t.Errorf("expected error: %v but got: %v", test.errExpected, err)
+			}
+			if test.valueExpected != value {
+				t.Errorf("expected value: %q but got: %q", test.valueExpected, value)
+			}
+			if test.attemptsExpected != attempts {
+				t.Errorf("expected attempts count: %d but got: %d", test.attemptsExpected, attempts)
+			}
+		})
+	}
+}
+
+func TestPollUntilContextCancelStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	called := make(chan struct{})
+	pollDone := make(chan error)
+
+	go func() {
+		_, err := PollUntilContextCancel(ctx, time.Microsecond, false, func(context.Context) (int, bool, error) {
+			called <- struct{}{}
+			return 0, false, nil
+		})
+		pollDone <- err
+	}()
+
+	// make sure we're called once
+	<-called
+	cancel()
+
+	go func() {
+		// release the condition func if needed
+		for {
+			<-called
+		}
+	}()
+
+	if err := <-pollDone; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestPollUntilContextTimeout(t *testing.T) {
+	var attempts int32
+	value, err := PollUntilContextTimeout(context.Background(), time.Millisecond, 20*time.Millisecond, true, func(context.Context) (int, bool, error) {
+		return int(atomic.AddInt32(&attempts, 1)), false, nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if value != 0 {
+		t.Errorf("expected the zero value, got %d", value)
+	}
+	if atomic.LoadInt32(&attempts) < 2 {
+		t.Errorf("expected several attempts, got %d", attempts)
+	}
+}